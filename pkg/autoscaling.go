@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+)
+
+// horizontalPodAutoscalerV2 holds the fields of an autoscaling/v2beta1, v2beta2 or v2
+// HorizontalPodAutoscaler. Metrics and behavior are kept as they are, their shape changed between
+// these versions.
+type horizontalPodAutoscalerV2 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		ScaleTargetRef v1.CrossVersionObjectReference `json:"scaleTargetRef"`
+		MinReplicas    *int32                         `json:"minReplicas,omitempty"`
+		MaxReplicas    int32                          `json:"maxReplicas"`
+		Metrics        []interface{}                  `json:"metrics,omitempty"`
+		Behavior       map[string]interface{}         `json:"behavior,omitempty"`
+	} `json:"spec"`
+}
+
+func horizontalPodAutoscalerV2Template(hpa horizontalPodAutoscalerV2) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&hpa.ObjectMeta)
+	cleanUpDecorators(hpa.ObjectMeta.Annotations)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(hpa.ObjectMeta.Name)
+	hpa.ObjectMeta = generateObjectMetaTemplate(hpa.ObjectMeta, key, value, hpa.ObjectMeta.Name)
+
+	if hpa.APIVersion == autoscalingV2beta1 && convertsFromV2beta1(hpa.TypeMeta) {
+		hpa.Spec.Metrics = metricsV2(hpa.Spec.Metrics)
+	}
+	if len(hpa.Spec.Metrics) != 0 {
+		value[Metrics] = hpa.Spec.Metrics
+	}
+	if len(hpa.Spec.Behavior) != 0 {
+		value[Behavior] = hpa.Spec.Behavior
+	}
+	hpa.Spec.Metrics = nil
+	hpa.Spec.Behavior = nil
+
+	hpaData, err := ylib.Marshal(hpa)
+	if err != nil {
+		log.Fatal(err)
+	}
+	template := removeEmptyFields(string(hpaData))
+	if hpa.Spec.MinReplicas != nil {
+		template = updateIntParamAsStringInTemplate(template, key, MinReplicas)
+		value[MinReplicas] = hpa.Spec.MinReplicas
+	}
+	template = updateIntParamAsStringInTemplate(template, key, MaxReplicas)
+	value[MaxReplicas] = hpa.Spec.MaxReplicas
+
+	var buf bytes.Buffer
+	for _, field := range []string{Metrics, Behavior} {
+		fmt.Fprintf(&buf, "  {{- with .Values.%s.%s }}\n", key, field)
+		fmt.Fprintf(&buf, "  %s:\n{{ toYaml . | indent 4 }}\n  {{- end }}\n", field)
+	}
+	// spec is the last field of the template.
+	return template + buf.String(), valueFileGenerator{value: value}
+}
+
+const autoscalingV2beta1 = "autoscaling/v2beta1"
+
+// convertsFromV2beta1 reports whether the autoscaling/v2beta1 HPAs of typeMeta get a newer apiVersion
+// in TargetKubeVersion, whose metrics have the shape of autoscaling/v2. If the oldest versions of the
+// range only serve v2beta1, its metrics can't be used there.
+func convertsFromV2beta1(typeMeta metav1.TypeMeta) bool {
+	served, ok := TargetKubeVersion.served(typeMeta)
+	if !ok || len(served) == 0 || served[len(served)-1].apiVersion == autoscalingV2beta1 {
+		return false
+	}
+	if served[0].apiVersion == autoscalingV2beta1 {
+		fmt.Printf("WARNING: metrics of autoscaling/v2beta1 are rendered as those of autoscaling/v2, Kubernetes 1.%d to 1.%d can't use them\n", served[0].from, served[0].to)
+	}
+	return true
+}
+
+// metricsV2 converts metrics of an autoscaling/v2beta1 HPA to autoscaling/v2beta2 and v2, which
+// moved the target of every metric to a target field and its name and selector to a metric field.
+func metricsV2(metrics []interface{}) []interface{} {
+	var converted []interface{}
+	for _, m := range metrics {
+		metric, _ := m.(map[string]interface{})
+		metricType, _ := metric["type"].(string)
+		field := map[string]string{"Resource": "resource", "Pods": "pods", "Object": "object", "External": "external"}[metricType]
+		source, ok := metric[field].(map[string]interface{})
+		if !ok {
+			converted = append(converted, m)
+			continue
+		}
+		v2 := make(map[string]interface{})
+		target := make(map[string]interface{})
+		switch {
+		case source["targetAverageUtilization"] != nil:
+			target["type"], target["averageUtilization"] = "Utilization", source["targetAverageUtilization"]
+		case source["targetAverageValue"] != nil:
+			target["type"], target["averageValue"] = "AverageValue", source["targetAverageValue"]
+		case source["averageValue"] != nil:
+			target["type"], target["averageValue"] = "AverageValue", source["averageValue"]
+		case source["targetValue"] != nil:
+			target["type"], target["value"] = "Value", source["targetValue"]
+		}
+		v2["target"] = target
+		if metricType == "Resource" {
+			v2["name"] = source["name"]
+		} else {
+			id := map[string]interface{}{"name": source["metricName"]}
+			if selector := source["selector"]; selector != nil {
+				id["selector"] = selector
+			}
+			if selector := source["metricSelector"]; selector != nil {
+				id["selector"] = selector
+			}
+			v2["metric"] = id
+		}
+		if metricType == "Object" {
+			v2["describedObject"] = source["target"]
+		}
+		converted = append(converted, map[string]interface{}{"type": metricType, field: v2})
+	}
+	return converted
+}
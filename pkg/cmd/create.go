@@ -12,9 +12,16 @@ import (
 
 func NewCmdCreate() *cobra.Command {
 	var (
-		kubeDir      string
+		kubeDirs     []string
+		filenames    []string
+		filter       pkg.FileFilter
+		cluster      pkg.ClusterConfig
+		sanitizeFile string
 		chartDir     string
 		preserveName bool
+		crdHook      bool
+		kubeVersion  string
+		genCerts     bool
 	)
 	ko := pkg.KubeObjects{}
 
@@ -27,26 +34,97 @@ func NewCmdCreate() *cobra.Command {
 				os.Exit(1)
 			}
 			gen := pkg.Generator{
-				Location:  checkLocation(chartDir),
-				ChartName: args[0],
+				Location:        checkLocation(chartDir),
+				ChartName:       args[0],
+				CRDInstallHook:  crdHook,
+				GenWebhookCerts: genCerts,
 			}
 			pkg.PreserveName = preserveName
-			if len(kubeDir) != 0 {
-				gen.YamlFiles = pkg.ReadLocalFiles(kubeDir)
+			if len(kubeVersion) != 0 {
+				r, err := pkg.ParseKubeVersionRange(kubeVersion)
+				if err != nil {
+					log.Fatal(err)
+				}
+				gen.KubeVersion = r
+			}
+			if len(sanitizeFile) != 0 {
+				rules, err := pkg.ReadSanitizeConfig(sanitizeFile)
+				if err != nil {
+					log.Fatal(err)
+				}
+				gen.SanitizeRules = rules
+			}
+			if len(kubeDirs) != 0 || len(filenames) != 0 {
+				for _, dir := range kubeDirs {
+					yamlFiles, sources, err := pkg.ReadLocalFiles(dir, filter)
+					if err != nil {
+						log.Fatal(err)
+					}
+					gen.YamlFiles = append(gen.YamlFiles, yamlFiles...)
+					gen.Sources = append(gen.Sources, sources...)
+				}
+				for _, filename := range filenames {
+					yamlFiles, sources, err := pkg.ReadFile(filename, filter)
+					if err != nil {
+						log.Fatal(err)
+					}
+					gen.YamlFiles = append(gen.YamlFiles, yamlFiles...)
+					gen.Sources = append(gen.Sources, sources...)
+				}
 			} else {
 				ok := ko.CheckFlags()
 				if !ok {
 					fmt.Println("No object given.")
 					os.Exit(1)
 				}
-				gen.YamlFiles = ko.Extract()
+				kubeClient, namespace, err := pkg.NewKubeClient(cluster)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if len(ko.Namespace) == 0 {
+					ko.Namespace = namespace
+				}
+				yamlFiles, err := ko.Extract(kubeClient)
+				if errs, ok := err.(pkg.ExtractErrors); ok {
+					// The objects that were read still make a chart.
+					fmt.Printf("WARNING: %v\n", errs)
+				} else if err != nil {
+					log.Fatal(err)
+				}
+				if len(yamlFiles) == 0 {
+					fmt.Println("No object could be read.")
+					os.Exit(1)
+				}
+				gen.YamlFiles = yamlFiles
 			}
 			gen.Create()
 		},
 	}
-	cmd.Flags().StringVar(&kubeDir, "kube-dir", "", "Specify the directory of the yaml files for Kubernetes objects")
+	cmd.Flags().StringArrayVar(&kubeDirs, "kube-dir", kubeDirs, "Specify the directories of the yaml files for Kubernetes objects")
+	cmd.Flags().StringSliceVarP(&filenames, "filename", "f", filenames, "Specify files or .tar, .tar.gz, .zip archives of Kubernetes objects, - to read from stdin")
+	cmd.Flags().StringArrayVar(&filter.Include, "include", filter.Include, "Glob of files to read from kube-dir (default: *.yaml, *.yml, *.json)")
+	cmd.Flags().StringArrayVar(&filter.Exclude, "exclude", filter.Exclude, "Glob of files or directories to skip in kube-dir")
+	cmd.Flags().StringVar(&sanitizeFile, "sanitize-config", sanitizeFile, "Config file with extra annotations, labels and fields to strip from objects")
 	cmd.Flags().StringVar(&chartDir, "chart-dir", "charts", "Specify the location where charts will be created")
+	cmd.Flags().BoolVar(&crdHook, "crd-install-hook", false, "Write CustomResourceDefinitions as Helm 2 crd-install hooks in templates instead of crds")
+	cmd.Flags().BoolVar(&genCerts, "gen-webhook-certs", false, "Generate the CA bundles of webhook configurations and their serving TLS Secret at install")
+	cmd.Flags().StringVar(&kubeVersion, "kube-version", kubeVersion, "Kubernetes version, or min-max range, the chart is generated for, e.g. 1.25 or 1.16-1.25")
 	cmd.Flags().BoolVar(&preserveName, "preserve-name", false, "Specify if you want to preserve resources name from input yaml true/false (default: false)")
+	cmd.Flags().StringVarP(&ko.Namespace, "namespace", "n", ko.Namespace, "Specify the namespace searched by --selector and --all-in-namespace (default: the namespace of the kubeconfig context)")
+	cmd.Flags().StringVarP(&ko.Selector, "selector", "l", ko.Selector, "Include objects of every supported kind matching this label selector in chart")
+	cmd.Flags().BoolVar(&ko.AllInNamespace, "all-in-namespace", ko.AllInNamespace, "Include every object of a supported kind in the namespace in chart")
+	cmd.Flags().BoolVar(&ko.WithDependencies, "with-dependencies", ko.WithDependencies, "Include the objects referenced by the selected workloads, the services selecting them and their autoscalers in chart")
+	cmd.Flags().StringVar(&cluster.Kubeconfig, "kubeconfig", cluster.Kubeconfig, "Path to the kubeconfig file to use for CLI requests")
+	cmd.Flags().StringVar(&cluster.Context, "context", cluster.Context, "The name of the kubeconfig context to use")
+	cmd.Flags().StringVar(&cluster.Cluster, "cluster", cluster.Cluster, "The name of the kubeconfig cluster to use")
+	cmd.Flags().StringVar(&cluster.User, "user", cluster.User, "The name of the kubeconfig user to use")
+	cmd.Flags().StringVar(&cluster.As, "as", cluster.As, "Username to impersonate for the operation")
+	cmd.Flags().StringArrayVar(&cluster.AsGroups, "as-group", cluster.AsGroups, "Group to impersonate for the operation, this flag can be repeated to specify multiple groups")
+	cmd.Flags().StringVar(&cluster.RequestTimeout, "request-timeout", cluster.RequestTimeout, "The length of time to wait before giving up on a single server request (e.g. 1s, 2m, 3h). 0 means no timeout")
+	cmd.Flags().BoolVar(&cluster.InsecureSkipTLSVerify, "insecure-skip-tls-verify", cluster.InsecureSkipTLSVerify, "If true, the server's certificate will not be checked for validity")
+	cmd.Flags().Float32Var(&cluster.QPS, "qps", 5, "Maximum number of requests per second to the cluster")
+	cmd.Flags().IntVar(&cluster.Burst, "burst", 10, "Maximum burst of requests to the cluster above --qps")
+	cmd.Flags().IntVar(&ko.Concurrency, "concurrency", 5, "Maximum number of objects read from the cluster in parallel")
 	cmd.Flags().StringSliceVar(&ko.ConfigMaps, "configmaps", ko.ConfigMaps, "Specify the names of configmaps(configmap@namespace) to include in chart")
 	cmd.Flags().StringSliceVar(&ko.Daemons, "daemons", ko.Daemons, "Specify the names of daemons(daemon@namespace) to include in chart")
 	cmd.Flags().StringSliceVar(&ko.Deployments, "deployments", ko.Deployments, "Specify the names of deployments(deployments@namespace) to include in chart")
@@ -60,6 +138,8 @@ func NewCmdCreate() *cobra.Command {
 	cmd.Flags().StringSliceVar(&ko.Services, "services", ko.Services, "Specify the names of services(service@namespace) to include in chart")
 	cmd.Flags().StringSliceVar(&ko.StatefulSets, "statefulsets", ko.StatefulSets, "Specify the names of statefulsets(statefulset@namespace) to include in chart")
 	cmd.Flags().StringSliceVar(&ko.StorageClasses, "storageclasses", ko.StorageClasses, "Specify the names of storageclasses(storageclass@namespace) to include in chart")
+	cmd.Flags().StringSliceVar(&ko.ServiceAccounts, "serviceaccounts", ko.ServiceAccounts, "Specify the names of service accounts(serviceaccount@namespace) to include in chart")
+	cmd.Flags().StringSliceVar(&ko.Resources, "resource", ko.Resources, "Specify objects of any kind(kind/name@namespace) to include in chart, or just a kind to include every object of it matching --selector or --all-in-namespace")
 	cmd.Flags().StringSliceVar(&ko.HorizontalPodAutoscalers, "horizontalpodautoscalers", ko.HorizontalPodAutoscalers, "Specify the names of horizontalpodautoscalers(horizontalpodautoscaler@namespace) to include in chart")
 
 	return cmd
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const crdInstallHook = "crd-install"
+
+// objectHeader holds the type and metadata of any object.
+type objectHeader struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+// isCustomResource reports whether objects of typeMeta are custom resources, that is their group is
+// defined by a CustomResourceDefinition of the chart or isn't a Kubernetes group.
+func isCustomResource(typeMeta metav1.TypeMeta) bool {
+	group := typeMeta.GroupVersionKind().Group
+	if len(group) == 0 {
+		return false
+	}
+	for _, name := range ChartObject["CustomResourceDefinition"] {
+		if strings.HasSuffix(name, "."+group) {
+			return true
+		}
+	}
+	return strings.Contains(group, ".") && !strings.HasSuffix(group, ".k8s.io")
+}
+
+// crdTemplate returns the CustomResourceDefinition as is. With hook it is annotated as a Helm 2
+// crd-install hook, to be placed in templates, and its template text is escaped.
+func crdTemplate(crdJson []byte, hook bool) string {
+	if hook {
+		crd := make(map[string]interface{})
+		if err := json.Unmarshal(crdJson, &crd); err != nil {
+			log.Fatal(err)
+		}
+		metadata, _ := crd["metadata"].(map[string]interface{})
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		if annotations == nil {
+			annotations = make(map[string]interface{})
+		}
+		annotations["helm.sh/hook"] = crdInstallHook
+		metadata["annotations"] = annotations
+		crd["metadata"] = metadata
+		crd = escapeTemplateText(crd).(map[string]interface{})
+		var err error
+		if crdJson, err = json.Marshal(crd); err != nil {
+			log.Fatal(err)
+		}
+	}
+	crdData, err := ylib.JSONToYAML(crdJson)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(crdData)
+}
+
+// customResourceTemplate templates the metadata of a custom resource. The rest of it is kept as is,
+// since empty fields may have a meaning to its controller.
+func customResourceTemplate(crJson []byte) (string, valueFileGenerator) {
+	template, values, _ := unstructuredTemplate(crJson)
+	return template, values
+}
@@ -0,0 +1,389 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	autoscaling "k8s.io/client-go/pkg/apis/autoscaling/v1"
+)
+
+type objectRef struct {
+	Kind      string
+	Name      string
+	Namespace string
+}
+
+func (r objectRef) String() string {
+	if len(r.Namespace) == 0 {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s@%s", r.Kind, r.Name, r.Namespace)
+}
+
+// DependencyGraph records why objects were pulled into a chart by --with-dependencies.
+type DependencyGraph struct {
+	roots []objectRef
+	edges map[objectRef][]objectRef
+}
+
+func (g DependencyGraph) String() string {
+	s := ""
+	seen := make(map[objectRef]bool)
+	var visit func(ref objectRef, indent string)
+	visit = func(ref objectRef, indent string) {
+		s = s + indent + ref.String() + "\n"
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+		for _, dep := range g.edges[ref] {
+			visit(dep, indent+"  -> ")
+		}
+	}
+	for _, root := range g.roots {
+		if !seen[root] {
+			visit(root, "")
+		}
+	}
+	return s
+}
+
+func (g *DependencyGraph) addEdge(from, to objectRef) bool {
+	for _, v := range g.edges[from] {
+		if v == to {
+			return false
+		}
+	}
+	g.edges[from] = append(g.edges[from], to)
+	return true
+}
+
+// names returns the name list of ko that holds objects of kind.
+func (ko *KubeObjects) names(kind string) *[]string {
+	switch kind {
+	case "ConfigMap":
+		return &ko.ConfigMaps
+	case "Deployment":
+		return &ko.Deployments
+	case "DaemonSet":
+		return &ko.Daemons
+	case "Job":
+		return &ko.Jobs
+	case "PersistentVolume":
+		return &ko.PersistentVolumes
+	case "PersistentVolumeClaim":
+		return &ko.PersistentVolumeClaims
+	case "Pod":
+		return &ko.Pods
+	case "ReplicaSet":
+		return &ko.ReplicaSets
+	case "ReplicationController":
+		return &ko.ReplicationControllers
+	case "Secret":
+		return &ko.Secrets
+	case "Service":
+		return &ko.Services
+	case "ServiceAccount":
+		return &ko.ServiceAccounts
+	case "StatefulSet":
+		return &ko.StatefulSets
+	case "StorageClass":
+		return &ko.StorageClasses
+	case "HorizontalPodAutoscaler":
+		return &ko.HorizontalPodAutoscalers
+	}
+	return nil
+}
+
+var dependencyKinds = []string{
+	"Pod", "ReplicationController", "Deployment", "DaemonSet", "ReplicaSet", "StatefulSet", "Job",
+	"Service", "HorizontalPodAutoscaler", "ConfigMap", "Secret", "ServiceAccount",
+	"PersistentVolumeClaim", "PersistentVolume", "StorageClass",
+}
+
+// resolveDependencies adds every object referenced by the selected workloads to ko, along with
+// the Services selecting their pods, the HPAs scaling them and the PVC -> PV -> StorageClass chain.
+func (ko *KubeObjects) resolveDependencies(kubeClient clientset.Interface) (DependencyGraph, error) {
+	graph := DependencyGraph{edges: make(map[objectRef][]objectRef)}
+	var queue []objectRef
+	for _, kind := range dependencyKinds {
+		for _, v := range *ko.names(kind) {
+			ref := objectRef{Kind: kind}
+			if kind == "PersistentVolume" || kind == "StorageClass" {
+				ref.Name = v
+			} else {
+				var err error
+				if ref.Name, ref.Namespace, err = splitNamespace(v); err != nil {
+					return graph, err
+				}
+			}
+			graph.roots = append(graph.roots, ref)
+			queue = append(queue, ref)
+		}
+	}
+
+	r := dependencyResolver{
+		kubeClient: kubeClient,
+		services:   make(map[string][]apiv1.Service),
+		hpas:       make(map[string][]autoscaling.HorizontalPodAutoscaler),
+	}
+	visited := make(map[objectRef]bool)
+	for len(queue) != 0 {
+		ref := queue[0]
+		queue = queue[1:]
+		if visited[ref] {
+			continue
+		}
+		visited[ref] = true
+
+		deps, err := r.dependenciesOf(ref)
+		if err != nil {
+			return graph, fmt.Errorf("failed to resolve dependencies of %s: %v", ref, err)
+		}
+		for _, dep := range deps {
+			if !graph.addEdge(ref, dep) {
+				continue
+			}
+			ko.add(dep)
+			queue = append(queue, dep)
+		}
+	}
+	return graph, nil
+}
+
+func (ko *KubeObjects) add(ref objectRef) {
+	names := ko.names(ref.Kind)
+	name := ref.Name
+	if len(ref.Namespace) != 0 {
+		name = name + "@" + ref.Namespace
+	}
+	for _, v := range *names {
+		if v == name {
+			return
+		}
+	}
+	*names = append(*names, name)
+}
+
+type dependencyResolver struct {
+	kubeClient clientset.Interface
+	services   map[string][]apiv1.Service
+	hpas       map[string][]autoscaling.HorizontalPodAutoscaler
+}
+
+func (r *dependencyResolver) dependenciesOf(ref objectRef) ([]objectRef, error) {
+	var podSpec *apiv1.PodSpec
+	var podLabels map[string]string
+	var claimTemplates []apiv1.PersistentVolumeClaim
+	scalable := false
+	ns := ref.Namespace
+
+	switch ref.Kind {
+	case "Pod":
+		obj, err := r.kubeClient.CoreV1().Pods(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec, obj.Labels
+	case "ReplicationController":
+		obj, err := r.kubeClient.CoreV1().ReplicationControllers(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if obj.Spec.Template != nil {
+			podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+		}
+		scalable = true
+	case "Deployment":
+		obj, err := r.kubeClient.ExtensionsV1beta1().Deployments(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+		scalable = true
+	case "DaemonSet":
+		obj, err := r.kubeClient.ExtensionsV1beta1().DaemonSets(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+	case "ReplicaSet":
+		obj, err := r.kubeClient.ExtensionsV1beta1().ReplicaSets(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+		scalable = true
+	case "StatefulSet":
+		obj, err := r.kubeClient.AppsV1beta1().StatefulSets(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+		claimTemplates = obj.Spec.VolumeClaimTemplates
+		scalable = true
+	case "Job":
+		obj, err := r.kubeClient.BatchV1().Jobs(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		podSpec, podLabels = &obj.Spec.Template.Spec, obj.Spec.Template.Labels
+	case "PersistentVolumeClaim":
+		obj, err := r.kubeClient.CoreV1().PersistentVolumeClaims(ns).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		var deps []objectRef
+		if len(obj.Spec.VolumeName) != 0 {
+			deps = append(deps, objectRef{Kind: "PersistentVolume", Name: obj.Spec.VolumeName})
+		}
+		if sc := apiv1.GetPersistentVolumeClaimClass(obj); len(sc) != 0 {
+			deps = append(deps, objectRef{Kind: "StorageClass", Name: sc})
+		}
+		return deps, nil
+	case "PersistentVolume":
+		obj, err := r.kubeClient.CoreV1().PersistentVolumes().Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if sc := apiv1.GetPersistentVolumeClass(obj); len(sc) != 0 {
+			return []objectRef{{Kind: "StorageClass", Name: sc}}, nil
+		}
+		return nil, nil
+	default:
+		return nil, nil
+	}
+
+	var deps []objectRef
+	if podSpec != nil {
+		deps = podSpecDependencies(*podSpec, ns)
+	}
+	for i := range claimTemplates {
+		if sc := apiv1.GetPersistentVolumeClaimClass(&claimTemplates[i]); len(sc) != 0 {
+			deps = append(deps, objectRef{Kind: "StorageClass", Name: sc})
+		}
+	}
+	if len(podLabels) != 0 {
+		services, err := r.servicesIn(ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range services {
+			if len(svc.Spec.Selector) != 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(podLabels)) {
+				deps = append(deps, objectRef{Kind: "Service", Name: svc.Name, Namespace: ns})
+			}
+		}
+	}
+	if scalable {
+		hpas, err := r.hpasIn(ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, hpa := range hpas {
+			if hpa.Spec.ScaleTargetRef.Kind == ref.Kind && hpa.Spec.ScaleTargetRef.Name == ref.Name {
+				deps = append(deps, objectRef{Kind: "HorizontalPodAutoscaler", Name: hpa.Name, Namespace: ns})
+			}
+		}
+	}
+	return deps, nil
+}
+
+func (r *dependencyResolver) servicesIn(namespace string) ([]apiv1.Service, error) {
+	if services, found := r.services[namespace]; found {
+		return services, nil
+	}
+	list, err := r.kubeClient.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r.services[namespace] = list.Items
+	return list.Items, nil
+}
+
+func (r *dependencyResolver) hpasIn(namespace string) ([]autoscaling.HorizontalPodAutoscaler, error) {
+	if hpas, found := r.hpas[namespace]; found {
+		return hpas, nil
+	}
+	list, err := r.kubeClient.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r.hpas[namespace] = list.Items
+	return list.Items, nil
+}
+
+// podSpecDependencies returns the objects a pod spec refers to through volumes, envFrom,
+// valueFrom, imagePullSecrets and serviceAccountName.
+func podSpecDependencies(spec apiv1.PodSpec, namespace string) []objectRef {
+	refs := make(map[objectRef]bool)
+	add := func(kind, name string) {
+		if len(name) != 0 {
+			refs[objectRef{Kind: kind, Name: name, Namespace: namespace}] = true
+		}
+	}
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil {
+			add("ConfigMap", v.ConfigMap.Name)
+		}
+		if v.Secret != nil {
+			add("Secret", v.Secret.SecretName)
+		}
+		if v.PersistentVolumeClaim != nil {
+			add("PersistentVolumeClaim", v.PersistentVolumeClaim.ClaimName)
+		}
+		if v.Projected != nil {
+			for _, p := range v.Projected.Sources {
+				if p.ConfigMap != nil {
+					add("ConfigMap", p.ConfigMap.Name)
+				}
+				if p.Secret != nil {
+					add("Secret", p.Secret.Name)
+				}
+			}
+		}
+	}
+	containers := append(append([]apiv1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil {
+				add("ConfigMap", e.ConfigMapRef.Name)
+			}
+			if e.SecretRef != nil {
+				add("Secret", e.SecretRef.Name)
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				add("ConfigMap", e.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				add("Secret", e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+	for _, s := range spec.ImagePullSecrets {
+		add("Secret", s.Name)
+	}
+	if spec.ServiceAccountName != "" && spec.ServiceAccountName != "default" {
+		add("ServiceAccount", spec.ServiceAccountName)
+	}
+
+	var result []objectRef
+	for ref := range refs {
+		result = append(result, ref)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
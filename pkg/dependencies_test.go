@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	autoscaling "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func TestPodSpecDependencies(t *testing.T) {
+	spec := apiv1.PodSpec{
+		ServiceAccountName: "api",
+		ImagePullSecrets:   []apiv1.LocalObjectReference{{Name: "registry"}},
+		Volumes: []apiv1.Volume{
+			{Name: "config", VolumeSource: apiv1.VolumeSource{ConfigMap: &apiv1.ConfigMapVolumeSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "api-config"}}}},
+			{Name: "data", VolumeSource: apiv1.VolumeSource{PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{ClaimName: "api-data"}}},
+		},
+		Containers: []apiv1.Container{
+			{
+				Name:    "api",
+				EnvFrom: []apiv1.EnvFromSource{{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "api-env"}}}},
+				Env: []apiv1.EnvVar{
+					{Name: "PASSWORD", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{LocalObjectReference: apiv1.LocalObjectReference{Name: "api-env"}, Key: "password"}}},
+					{Name: "MODE", ValueFrom: &apiv1.EnvVarSource{ConfigMapKeyRef: &apiv1.ConfigMapKeySelector{LocalObjectReference: apiv1.LocalObjectReference{Name: "api-mode"}, Key: "mode"}}},
+				},
+			},
+		},
+	}
+	expected := []objectRef{
+		{Kind: "ConfigMap", Name: "api-config", Namespace: "prod"},
+		{Kind: "ConfigMap", Name: "api-mode", Namespace: "prod"},
+		{Kind: "PersistentVolumeClaim", Name: "api-data", Namespace: "prod"},
+		{Kind: "Secret", Name: "api-env", Namespace: "prod"},
+		{Kind: "Secret", Name: "registry", Namespace: "prod"},
+		{Kind: "ServiceAccount", Name: "api", Namespace: "prod"},
+	}
+	assert.Equal(t, expected, podSpecDependencies(spec, "prod"))
+}
+
+func TestResolveDependencies(t *testing.T) {
+	fast := "fast"
+	podLabels := map[string]string{"app": "web", "tier": "front"}
+	kubeClient := newFakeClientset(
+		&extensions.Deployment{
+			ObjectMeta: objectMeta("web", "prod"),
+			Spec: extensions.DeploymentSpec{Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: apiv1.PodSpec{Volumes: []apiv1.Volume{
+					{Name: "data", VolumeSource: apiv1.VolumeSource{PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+				}},
+			}},
+		},
+		&apiv1.Service{ObjectMeta: objectMeta("web", "prod"), Spec: apiv1.ServiceSpec{Selector: map[string]string{"app": "web"}}},
+		&apiv1.Service{ObjectMeta: objectMeta("db", "prod"), Spec: apiv1.ServiceSpec{Selector: map[string]string{"app": "db"}}},
+		&apiv1.Service{ObjectMeta: objectMeta("external", "prod")},
+		&apiv1.Service{ObjectMeta: objectMeta("web", "staging"), Spec: apiv1.ServiceSpec{Selector: map[string]string{"app": "web"}}},
+		&autoscaling.HorizontalPodAutoscaler{
+			ObjectMeta: objectMeta("web", "prod"),
+			Spec:       autoscaling.HorizontalPodAutoscalerSpec{ScaleTargetRef: autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "web"}},
+		},
+		&autoscaling.HorizontalPodAutoscaler{
+			ObjectMeta: objectMeta("web-rs", "prod"),
+			Spec:       autoscaling.HorizontalPodAutoscalerSpec{ScaleTargetRef: autoscaling.CrossVersionObjectReference{Kind: "ReplicaSet", Name: "web"}},
+		},
+		&autoscaling.HorizontalPodAutoscaler{
+			ObjectMeta: objectMeta("worker", "prod"),
+			Spec:       autoscaling.HorizontalPodAutoscalerSpec{ScaleTargetRef: autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "worker"}},
+		},
+		&apiv1.PersistentVolumeClaim{
+			ObjectMeta: objectMeta("data", "prod"),
+			Spec:       apiv1.PersistentVolumeClaimSpec{VolumeName: "pv-data", StorageClassName: &fast},
+		},
+		&apiv1.PersistentVolume{ObjectMeta: objectMeta("pv-data", ""), Spec: apiv1.PersistentVolumeSpec{StorageClassName: fast}},
+	)
+
+	ko := KubeObjects{Deployments: []string{"web@prod"}}
+	graph, err := ko.resolveDependencies(kubeClient)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"web@prod"}, ko.Services)
+	assert.Equal(t, []string{"web@prod"}, ko.HorizontalPodAutoscalers)
+	assert.Equal(t, []string{"data@prod"}, ko.PersistentVolumeClaims)
+	assert.Equal(t, []string{"pv-data"}, ko.PersistentVolumes)
+	assert.Equal(t, []string{"fast"}, ko.StorageClasses)
+	assert.Equal(t, `Deployment web@prod
+  -> PersistentVolumeClaim data@prod
+  ->   -> PersistentVolume pv-data
+  ->   ->   -> StorageClass fast
+  ->   -> StorageClass fast
+  -> Service web@prod
+  -> HorizontalPodAutoscaler web@prod
+`, graph.String())
+}
+
+func TestResolveDependenciesFailure(t *testing.T) {
+	ko := KubeObjects{Deployments: []string{"gone@prod"}}
+	_, err := ko.resolveDependencies(newFakeClientset())
+	assert.EqualError(t, err, `failed to resolve dependencies of Deployment gone@prod: deployments "gone" not found`)
+}
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// extraLists maps the extra values appended to the lists of a pod spec to these lists.
+var extraLists = []struct{ extra, list string }{
+	{ExtraContainers, Containers},
+	{ExtraInitContainers, InitContainers},
+	{ExtraVolumes, Volumes},
+}
+
+// extraContainerLists maps the extra values appended to the lists of every container to these lists.
+var extraContainerLists = []struct{ extra, list string }{
+	{ExtraVolumeMounts, VolumeMounts},
+	{ExtraEnv, Env},
+	{ExtraEnvFrom, EnvFrom},
+}
+
+// addExtraValues renders the extra values of key, lists that default to empty, as items of the lists of
+// the pod spec at path and of its containers, so that sidecars, volumes and env can be added without
+// changing the template. The items are rendered with tpl, they may refer to the release.
+func addExtraValues(template string, key string, podSpec apiv1.PodSpec, value map[string]interface{}, path ...string) string {
+	lines := strings.Split(strings.TrimSuffix(template, "\n"), "\n")
+	for _, l := range extraLists {
+		value[l.extra] = []interface{}{}
+		lines = appendToList(lines, key, l.extra, append(path, l.list)...)
+	}
+	for _, l := range extraContainerLists {
+		value[l.extra] = []interface{}{}
+		for _, c := range podSpec.Containers {
+			lines = appendToContainerList(lines, key, l.extra, c.Name, l.list)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// extraTemplate renders the extra value of key as items of a list, indented by indent, or as the
+// field list if it is set.
+func extraTemplate(key string, extra string, list string, indent int) []string {
+	space := strings.Repeat(" ", indent)
+	items := fmt.Sprintf("{{- tpl (toYaml .) $ | nindent %d }}", indent)
+	if len(list) != 0 {
+		items = fmt.Sprintf("%s: {{- tpl (toYaml .) $ | nindent %d }}", list, indent+2)
+	}
+	return []string{
+		fmt.Sprintf("%s{{- with .Values.%s.%s }}", space, key, extra),
+		space + items,
+		space + "{{- end }}",
+	}
+}
+
+// appendToList appends the extra value of key to the list at path, or adds the list to the map holding
+// it.
+func appendToList(lines []string, key string, extra string, path ...string) []string {
+	if i, indent := findKey(lines, path...); i != -1 {
+		return insertLines(lines, listEnd(lines, i, indent), extraTemplate(key, extra, "", itemIndent(lines, i, indent)))
+	}
+	i, indent := findKey(lines, path[:len(path)-1]...)
+	if i == -1 {
+		return lines
+	}
+	return insertLines(lines, i+1, extraTemplate(key, extra, path[len(path)-1], indent+2))
+}
+
+// appendToContainerList appends the extra value of key to the list field of the container called name,
+// or adds the field to the container.
+func appendToContainerList(lines []string, key string, extra string, name string, list string) []string {
+	start, end, indent := findContainer(lines, Containers, name)
+	if start == -1 {
+		return lines
+	}
+	for i := start; i < end; i++ {
+		field, fieldIndent, _ := yamlField(lines[i])
+		if field == list+":" && fieldIndent == indent {
+			return insertLines(lines, listEnd(lines, i, indent), extraTemplate(key, extra, "", itemIndent(lines, i, indent)))
+		}
+	}
+	return insertLines(lines, end, extraTemplate(key, extra, list, indent))
+}
+
+// yamlField returns the field of a line, without the "- " of list items, the indentation of the field
+// and whether the line starts a list item. Template lines have no field.
+func yamlField(l string) (string, int, bool) {
+	trimmed := strings.TrimLeft(l, " ")
+	indent := len(l) - len(trimmed)
+	if strings.HasPrefix(trimmed, "{{") {
+		return "", indent, false
+	}
+	if strings.HasPrefix(trimmed, "- ") {
+		return trimmed[2:], indent + 2, true
+	}
+	return trimmed, indent, false
+}
+
+// findKey returns the line of the key at path, which doesn't go through lists, and the indentation of
+// the key, or -1.
+func findKey(lines []string, path ...string) (int, int) {
+	var stack []string
+	var indents []int
+	for i, l := range lines {
+		field, indent, item := yamlField(l)
+		if len(field) == 0 || item {
+			continue
+		}
+		for len(indents) != 0 && indents[len(indents)-1] >= indent {
+			stack, indents = stack[:len(stack)-1], indents[:len(indents)-1]
+		}
+		if !strings.HasSuffix(field, ":") {
+			continue
+		}
+		stack, indents = append(stack, strings.TrimSuffix(field, ":")), append(indents, indent)
+		if strings.Join(stack, ".") == strings.Join(path, ".") {
+			return i, indent
+		}
+	}
+	return -1, 0
+}
+
+// findContainer returns the lines of the item called name of a list of containers in lines, from start
+// up to end, and the indentation of its fields, or -1.
+func findContainer(lines []string, list string, name string) (int, int, int) {
+	type entry struct {
+		indent int
+		key    string
+	}
+	var stack []entry
+	for i, l := range lines {
+		field, fieldIndent, item := yamlField(l)
+		if len(field) == 0 {
+			continue
+		}
+		indent := fieldIndent
+		if item {
+			indent -= 2
+		}
+		// Items of a list may be indented as much as its key.
+		for len(stack) != 0 && (stack[len(stack)-1].indent > indent || !item && stack[len(stack)-1].indent == indent) {
+			stack = stack[:len(stack)-1]
+		}
+		if field == "name: "+name && len(stack) != 0 && stack[len(stack)-1].key == list {
+			start := i
+			for ; start > 0; start-- {
+				if _, startIndent, item := yamlField(lines[start]); item && startIndent == fieldIndent {
+					break
+				}
+			}
+			end := i + 1
+			for ; end < len(lines); end++ {
+				trimmed := strings.TrimLeft(lines[end], " ")
+				if len(lines[end])-len(trimmed) < fieldIndent {
+					break
+				}
+			}
+			return start, end, fieldIndent
+		}
+		if strings.HasSuffix(field, ":") {
+			stack = append(stack, entry{fieldIndent, strings.TrimSuffix(field, ":")})
+		}
+	}
+	return -1, -1, 0
+}
+
+// listEnd returns the line after the items of the list whose key is at line i, indented by indent.
+// Template lines as indented as the key may be part of the list, the items before them are complete.
+func listEnd(lines []string, i int, indent int) int {
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		lineIndent := len(lines[i]) - len(trimmed)
+		if lineIndent < indent || lineIndent == indent && !strings.HasPrefix(trimmed, "- ") {
+			break
+		}
+	}
+	return i
+}
+
+// itemIndent returns the indentation of the items of the list whose key is at line i, indented by indent.
+func itemIndent(lines []string, i int, indent int) int {
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if strings.HasPrefix(trimmed, "- ") {
+			return len(lines[i]) - len(trimmed)
+		}
+		if !strings.HasPrefix(trimmed, "{{") {
+			break
+		}
+	}
+	return indent
+}
+
+func insertLines(lines []string, i int, block []string) []string {
+	result := append([]string{}, lines[:i]...)
+	result = append(result, block...)
+	return append(result, lines[i:]...)
+}
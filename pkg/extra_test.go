@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// cronJobLines is the pod spec of a CronJob, as deep as pod specs get in templates.
+var cronJobLines = strings.Split(`spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: busybox
+            env:
+            - name: TARGET
+              value: s3
+          - name: web
+            image: nginx
+          volumes:
+          - name: data
+            emptyDir: {}`, "\n")
+
+var cronJobPodSpec = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+
+// templateListLines has an env list made of a template line only.
+var templateListLines = strings.Split(`spec:
+  containers:
+  - name: web
+    env:
+    {{- toYaml .Values.web.env | nindent 4 }}
+    image: nginx`, "\n")
+
+func TestFindKey(t *testing.T) {
+	cases := []struct {
+		path   []string
+		line   int
+		indent int
+	}{
+		{[]string{"spec"}, 0, 0},
+		{append(cronJobPodSpec, Containers), 5, 10},
+		{append(cronJobPodSpec, Volumes), 13, 10},
+		{append(cronJobPodSpec, InitContainers), -1, 0},
+		// Paths don't skip levels.
+		{[]string{"spec", "template", "spec"}, -1, 0},
+	}
+	for _, c := range cases {
+		line, indent := findKey(cronJobLines, c.path...)
+		assert.Equal(t, []int{c.line, c.indent}, []int{line, indent}, strings.Join(c.path, "."))
+	}
+	line, indent := findKey(templateListLines, "spec", Containers)
+	assert.Equal(t, []int{1, 2}, []int{line, indent})
+}
+
+func TestFindContainer(t *testing.T) {
+	cases := []struct {
+		lines              []string
+		name               string
+		start, end, indent int
+	}{
+		{cronJobLines, "backup", 6, 11, 12},
+		{cronJobLines, "web", 11, 13, 12},
+		{cronJobLines, "db", -1, -1, 0},
+		{templateListLines, "web", 2, 6, 4},
+	}
+	for _, c := range cases {
+		start, end, indent := findContainer(c.lines, Containers, c.name)
+		assert.Equal(t, []int{c.start, c.end, c.indent}, []int{start, end, indent}, c.name)
+	}
+	start, _, _ := findContainer(cronJobLines, InitContainers, "backup")
+	assert.Equal(t, -1, start)
+}
+
+func TestListEnd(t *testing.T) {
+	cases := []struct {
+		lines          []string
+		i, indent, end int
+	}{
+		{cronJobLines, 5, 10, 13},
+		{cronJobLines, 8, 12, 11},
+		{cronJobLines, 13, 10, 16},
+		// The items of the template line can't be appended to, the extra items go before them.
+		{templateListLines, 3, 4, 4},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.end, listEnd(c.lines, c.i, c.indent), c.lines[c.i])
+	}
+}
+
+func TestItemIndent(t *testing.T) {
+	cases := []struct {
+		lines             []string
+		i, indent, result int
+	}{
+		{cronJobLines, 5, 10, 10},
+		{cronJobLines, 8, 12, 12},
+		{templateListLines, 3, 4, 4},
+		{strings.Split("env:\n  {{- if .Values.debug }}\n  - name: DEBUG\n  {{- end }}", "\n"), 0, 0, 2},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.result, itemIndent(c.lines, c.i, c.indent), c.lines[c.i])
+	}
+}
+
+func TestAppendToContainerList(t *testing.T) {
+	cases := []struct {
+		name     string
+		lines    []string
+		list     string
+		expected string
+	}{
+		{
+			name: "backup",
+			list: Env,
+			expected: `          - name: backup
+            image: busybox
+            env:
+            - name: TARGET
+              value: s3
+            {{- with .Values.job.extraEnv }}
+            {{- tpl (toYaml .) $ | nindent 12 }}
+            {{- end }}
+          - name: web`,
+		},
+		{
+			name: "web",
+			list: VolumeMounts,
+			expected: `          - name: web
+            image: nginx
+            {{- with .Values.job.extraVolumeMounts }}
+            volumeMounts: {{- tpl (toYaml .) $ | nindent 14 }}
+            {{- end }}
+          volumes:`,
+		},
+		{
+			name:     "db",
+			list:     Env,
+			expected: "",
+		},
+	}
+	for _, c := range cases {
+		extra := ExtraEnv
+		if c.list == VolumeMounts {
+			extra = ExtraVolumeMounts
+		}
+		result := strings.Join(appendToContainerList(cronJobLines, "job", extra, c.name, c.list), "\n")
+		if len(c.expected) == 0 {
+			assert.Equal(t, strings.Join(cronJobLines, "\n"), result, c.name)
+			continue
+		}
+		assert.Contains(t, result, c.expected, c.name)
+	}
+
+	result := appendToContainerList(templateListLines, "web", ExtraEnv, "web", Env)
+	assert.Equal(t, `spec:
+  containers:
+  - name: web
+    env:
+    {{- with .Values.web.extraEnv }}
+    {{- tpl (toYaml .) $ | nindent 4 }}
+    {{- end }}
+    {{- toYaml .Values.web.env | nindent 4 }}
+    image: nginx`, strings.Join(result, "\n"))
+}
+
+func TestAppendToList(t *testing.T) {
+	result := strings.Join(appendToList(cronJobLines, "job", ExtraVolumes, append(cronJobPodSpec, Volumes)...), "\n")
+	assert.True(t, strings.HasSuffix(result, `          volumes:
+          - name: data
+            emptyDir: {}
+          {{- with .Values.job.extraVolumes }}
+          {{- tpl (toYaml .) $ | nindent 10 }}
+          {{- end }}`), result)
+
+	result = strings.Join(appendToList(cronJobLines, "job", ExtraInitContainers, append(cronJobPodSpec, InitContainers)...), "\n")
+	assert.Contains(t, result, `        spec:
+          {{- with .Values.job.extraInitContainers }}
+          initContainers: {{- tpl (toYaml .) $ | nindent 12 }}
+          {{- end }}
+          containers:`)
+}
+
+// renderExtraValues renders template with values the way Helm does, for the functions the templates
+// of extra values use.
+func renderExtraValues(t *testing.T, tmpl string, values map[string]interface{}) string {
+	root := map[string]interface{}{
+		"Values":  values,
+		"Release": map[string]interface{}{"Name": "rel", "Service": "Tiller"},
+		"Chart":   map[string]interface{}{"Name": "chart", "Version": "0.1.0"},
+	}
+	funcs := template.FuncMap{
+		"toYaml": func(v interface{}) string {
+			data, err := yaml.Marshal(v)
+			assert.Nil(t, err)
+			return strings.TrimSuffix(string(data), "\n")
+		},
+		"nindent": func(n int, s string) string {
+			indent := strings.Repeat(" ", n)
+			return "\n" + indent + strings.Replace(s, "\n", "\n"+indent, -1)
+		},
+	}
+	funcs["tpl"] = func(s string, data interface{}) string {
+		var buf bytes.Buffer
+		assert.Nil(t, template.Must(template.New("tpl").Funcs(funcs).Parse(s)).Execute(&buf, data))
+		return buf.String()
+	}
+	var buf bytes.Buffer
+	parsed := template.Must(template.New("chart").Funcs(funcs).Parse(`{{- define "fullname" }}rel-chart{{ end }}` + tmpl))
+	assert.Nil(t, parsed.Execute(&buf, root))
+	return buf.String()
+}
+
+func TestExtraValuesRendered(t *testing.T) {
+	yamlFile, err := ioutil.ReadFile("../testdata/deployment/input/deployment.yaml")
+	assert.Nil(t, err)
+	deployment := extensions.Deployment{}
+	assert.Nil(t, yaml.Unmarshal(yamlFile, &deployment))
+	template, values := deploymentTemplate(deployment)
+
+	extraFile, err := ioutil.ReadFile("../testdata/deployment/input/extra_values.yaml")
+	assert.Nil(t, err)
+	extra := make(map[string]interface{})
+	assert.Nil(t, yaml.Unmarshal(extraFile, &extra))
+	value := make(map[string]interface{})
+	data, err := yaml.Marshal(values.value)
+	assert.Nil(t, err)
+	assert.Nil(t, yaml.Unmarshal(data, &value))
+	for k, v := range extra {
+		value[k] = v
+	}
+	rendered := renderExtraValues(t, template, map[string]interface{}{generateSafeKey(deployment.Name): value})
+
+	obj := make(map[string]interface{})
+	assert.Nil(t, yaml.Unmarshal([]byte(rendered), &obj))
+	expected, err := ioutil.ReadFile("../testdata/deployment/output/deployment_extra_rendered.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), rendered)
+}
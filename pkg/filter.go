@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the gitignore style file that excludes paths from a --kube-dir.
+const IgnoreFileName = ".chartifyignore"
+
+var defaultExtensions = []string{".yaml", ".yml", ".json"}
+
+// FileFilter decides which files below a --kube-dir are read.
+// If Include is empty, files with a .yaml, .yml or .json extension are read.
+// Patterns without a "/" match the file name at any depth, others match the path
+// relative to the --kube-dir. "**" matches any number of directories.
+type FileFilter struct {
+	Include []string
+	Exclude []string
+}
+
+type ignoreRule struct {
+	base    string // directory of the ignore file, relative to the --kube-dir
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+type ignoreRules []ignoreRule
+
+// ignored reports whether relPath is excluded. As in gitignore, the last matching rule wins.
+func (rules ignoreRules) ignored(relPath string, isDir bool) bool {
+	result := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		p := relPath
+		if len(r.base) != 0 {
+			if !strings.HasPrefix(relPath, r.base+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(relPath, r.base+"/")
+		}
+		if r.regex.MatchString(p) {
+			result = !r.negate
+		}
+	}
+	return result
+}
+
+func readIgnoreFile(fileName string, base string) (ignoreRules, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		rule.dirOnly = strings.HasSuffix(line, "/")
+		regex, err := globToRegexp(strings.TrimSuffix(line, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		rule.regex = regex
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// accepts reports whether the file at relPath is read. The error is that of an invalid pattern.
+func (f FileFilter) accepts(relPath string) (bool, error) {
+	if len(f.Include) == 0 {
+		ext := strings.ToLower(path.Ext(relPath))
+		found := false
+		for _, e := range defaultExtensions {
+			if ext == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	} else if included, err := matchAny(f.Include, relPath); err != nil || !included {
+		return false, err
+	}
+	excluded, err := matchAny(f.Exclude, relPath)
+	return !excluded, err
+}
+
+func matchAny(patterns []string, relPath string) (bool, error) {
+	for _, p := range patterns {
+		regex, err := globToRegexp(p)
+		if err != nil {
+			return false, err
+		}
+		if regex.MatchString(relPath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// globToRegexp converts a gitignore style glob into a regular expression that
+// matches slash separated paths. Malformed character classes, like [z-a], are an error.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	glob := pattern
+	anchored := strings.Contains(strings.TrimPrefix(pattern, "**/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var buf bytes.Buffer
+	if !anchored {
+		buf.WriteString("^(.*/)?")
+	} else {
+		buf.WriteString("^")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					buf.WriteString("(.*/)?")
+				} else {
+					buf.WriteString(".*")
+				}
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 2 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := strings.Replace(pattern[i+1:i+end], `\`, `\\`, -1)
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + class + "]")
+			i += end
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A matching directory also matches everything below it.
+	buf.WriteString("(/.*)?$")
+	regex, err := regexp.Compile(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", glob, err)
+	}
+	return regex, nil
+}
+
+func relativeSlashPath(root, fileName string) string {
+	rel, err := filepath.Rel(root, fileName)
+	if err != nil {
+		return filepath.ToSlash(fileName)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -8,6 +8,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/appscode/go/encoding/yaml"
@@ -15,10 +17,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
-	apps "k8s.io/client-go/pkg/apis/apps/v1beta1"
 	v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
 	batch "k8s.io/client-go/pkg/apis/batch/v1"
+	batchv2 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
 	storage "k8s.io/client-go/pkg/apis/storage/v1"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 )
@@ -27,10 +30,26 @@ type Generator struct {
 	Location  string
 	ChartName string
 	YamlFiles []string
+	// Sources holds the origin of each entry of YamlFiles, if known.
+	Sources []Source
+	// SanitizeRules extends DefaultSanitizeRules.
+	SanitizeRules SanitizeRules
+	// CRDInstallHook writes CustomResourceDefinitions as Helm 2 crd-install hooks in templates
+	// instead of the crds directory.
+	CRDInstallHook bool
+	// KubeVersion is the range of Kubernetes versions the chart is generated for. Objects get the
+	// apiVersions served in it.
+	KubeVersion KubeVersionRange
+	// GenWebhookCerts replaces the CA bundles of webhook configurations and their serving TLS Secret
+	// with certificates generated at install.
+	GenWebhookCerts bool
 }
 
 var ChartObject map[string][]string
-var chnageObjectType = []string{"Secret", "Configmap", "PersistentVolume", "PersistentVolumeClaim"}
+
+// ReleaseLabels holds the pod labels, as key=value, that workloads of the chart prefix with the release name.
+var ReleaseLabels map[string]bool
+var chnageObjectType = []string{"Secret", "Configmap", "PersistentVolume", "PersistentVolumeClaim", "Service", "ServiceAccount", "Role", "ClusterRole", "CustomResourceDefinition", "PriorityClass"}
 
 func (g Generator) Create() (string, error) {
 	chartfile := chartMetaData(g.ChartName)
@@ -42,6 +61,7 @@ func (g Generator) Create() (string, error) {
 		return cdir, fmt.Errorf("%s already exists and is not a directory", cdir)
 	}
 	ChartObject = getInsideObjects(g.YamlFiles)
+	TargetKubeVersion = g.KubeVersion
 	if err := os.MkdirAll(cdir, 0755); err != nil {
 		return cdir, err
 	}
@@ -58,157 +78,342 @@ func (g Generator) Create() (string, error) {
 	persistence := make(map[string]interface{}, 0)
 	templateLocation := filepath.Join(cdir, TemplatesDir)
 	err = os.MkdirAll(templateLocation, 0755)
-	for _, kubeObj := range g.YamlFiles {
+	rules := DefaultSanitizeRules.Merge(g.SanitizeRules)
+	ReleaseLabels = getReleaseLabels(g.YamlFiles, rules)
+	TargetPorts = getTargetPorts(g.YamlFiles, rules)
+	certs := webhookCerts{}
+	if g.GenWebhookCerts {
+		var missing []string
+		certs, missing = getWebhookCerts(g.YamlFiles, rules)
+		for _, config := range missing {
+			fmt.Printf("%s: no TLS Secret of the chart is valid for its Service, its caBundle is kept\n", config)
+		}
+	}
+	var passedThrough, unserved []string
+	for i, kubeObj := range g.YamlFiles {
 		kubeJson, err := yaml.ToJSON([]byte(kubeObj))
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("%s: %v", g.sourceOf(i), err)
+		}
+		kubeJson, err = rules.SanitizeJSON(kubeJson)
+		if err != nil {
+			log.Fatalf("%s: %v", g.sourceOf(i), err)
 		}
 
 		var objMeta metav1.TypeMeta
 		if err := json.Unmarshal(kubeJson, &objMeta); err != nil {
-			log.Fatal(err)
+			log.Fatalf("%s: %v", g.sourceOf(i), err)
+		}
+
+		if !TargetKubeVersion.serves(objMeta) {
+			unserved = append(unserved, fmt.Sprintf("%s %s (%s)", objMeta.Kind, objMeta.APIVersion, g.sourceOf(i)))
+			continue
+		}
+		if TargetKubeVersion.isSet() {
+			kubeJson = defaultSelector(kubeJson)
 		}
 
 		values := valueFileGenerator{}
 		var template, templateName string
-		if objMeta.Kind == "Pod" {
+		kind := handledKind(objMeta)
+		if kind == "Pod" {
 			pod := apiv1.Pod{}
 			if err := json.Unmarshal(kubeJson, &pod); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := pod.Name
 			templateName = filepath.Join(templateLocation, name+".pod.yaml")
 			template, values = podTemplate(pod)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "ReplicationController" {
+		} else if kind == "ReplicationController" {
 			rc := apiv1.ReplicationController{}
 			if err := json.Unmarshal(kubeJson, &rc); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := rc.Name
 			templateName = filepath.Join(templateLocation, name+".rc.yaml")
 			template, values = replicationControllerTemplate(rc)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "Deployment" {
+		} else if kind == "Deployment" {
 			deployment := extensions.Deployment{}
 			if err := json.Unmarshal(kubeJson, &deployment); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := deployment.Name
 			templateName = filepath.Join(templateLocation, name+".deployment.yaml")
 			template, values = deploymentTemplate(deployment)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "Job" {
+		} else if kind == "Job" {
 			job := batch.Job{}
 			if err := json.Unmarshal(kubeJson, &job); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := job.Name
 			templateName = filepath.Join(templateLocation, name+".job.yaml")
 			template, values = jobTemplate(job)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "DaemonSet" {
+		} else if kind == "CronJob" {
+			cronJob := batchv2.CronJob{}
+			if err := json.Unmarshal(kubeJson, &cronJob); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := cronJob.Name
+			templateName = filepath.Join(templateLocation, name+".cronjob.yaml")
+			template, values = cronJobTemplate(cronJob)
+			values.MergeInto(valueFile, generateSafeKey(name))
+			persistence = addPersistence(persistence, values.persistence)
+		} else if kind == "DaemonSet" {
 			daemonset := extensions.DaemonSet{}
 			if err := json.Unmarshal(kubeJson, &daemonset); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := daemonset.Name
 			templateName = filepath.Join(templateLocation, name+".daemonset.yaml")
 			template, values = daemonsetTemplate(daemonset)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "ReplicaSet" {
+		} else if kind == "ReplicaSet" {
 			rcSet := extensions.ReplicaSet{}
 			if err := json.Unmarshal(kubeJson, &rcSet); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := rcSet.Name
 			templateName = filepath.Join(templateLocation, name+".rs.yaml")
 			template, values = replicaSetTemplate(rcSet)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "StatefulSet" {
-			statefulset := apps.StatefulSet{}
+		} else if kind == "StatefulSet" {
+			statefulset := statefulSet{}
 			if err := json.Unmarshal(kubeJson, &statefulset); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := statefulset.Name
 			templateName = filepath.Join(templateLocation, name+".statefulset.yaml")
 			template, values = statefulsetTemplate(statefulset)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "Service" {
+		} else if kind == "Service" {
 			service := apiv1.Service{}
 			if err := json.Unmarshal(kubeJson, &service); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			template, values = serviceTemplate(service)
 			name := service.Name
 			templateName = filepath.Join(templateLocation, name+".svc.yaml")
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "ConfigMap" {
+		} else if kind == "ConfigMap" {
 			configMap := apiv1.ConfigMap{}
 			if err := json.Unmarshal(kubeJson, &configMap); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := configMap.Name
 			templateName = filepath.Join(templateLocation, name+".yaml")
 			template, values = configMapTemplate(configMap)
 			values.MergeInto(valueFile, generateSafeKey(name))
-		} else if objMeta.Kind == "Secret" {
+		} else if kind == "Secret" && len(certs.bySecret[i]) != 0 {
+			secret := apiv1.Secret{}
+			if err := json.Unmarshal(kubeJson, &secret); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := secret.Name
+			templateName = filepath.Join(templateLocation, name+".webhook-certs.yaml")
+			template, values = webhookCertsTemplate(secret, certs.bySecret[i])
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "MutatingWebhookConfiguration" || kind == "ValidatingWebhookConfiguration" {
+			if certs.generated[i] {
+				// Rendered along with the serving Secret.
+				continue
+			}
+			config := webhookConfiguration{}
+			if err := json.Unmarshal(kubeJson, &config); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := config.Name
+			templateName = filepath.Join(templateLocation, name+"."+strings.ToLower(kind)+".yaml")
+			template, values = webhookConfigurationTemplate(config, nil)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "Secret" {
 			secret := apiv1.Secret{}
 			if err := json.Unmarshal(kubeJson, &secret); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := secret.Name
 			templateName = filepath.Join(templateLocation, name+".secret.yaml")
 			template, values = secretTemplate(secret)
 			values.MergeInto(valueFile, generateSafeKey(name))
-		} else if objMeta.Kind == "PersistentVolumeClaim" {
+		} else if kind == "PersistentVolumeClaim" {
 			pvc := apiv1.PersistentVolumeClaim{}
 			if err := json.Unmarshal(kubeJson, &pvc); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := pvc.Name
 			templateName = filepath.Join(templateLocation, name+".pvc.yaml")
 			template, values = pvcTemplate(pvc)
 			persistence = addPersistence(persistence, values.persistence)
-		} else if objMeta.Kind == "PersistentVolume" {
+		} else if kind == "PersistentVolume" {
 			pv := apiv1.PersistentVolume{}
 			if err := json.Unmarshal(kubeJson, &pv); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := pv.Name
 			templateName = filepath.Join(templateLocation, name+".pv.yaml")
 			template, values = pvTemplate(pv)
 			values.MergeInto(valueFile, generateSafeKey(name))
-		} else if objMeta.Kind == "StorageClass" {
+		} else if kind == "StorageClass" {
 			storageClass := storage.StorageClass{}
 			if err := json.Unmarshal(kubeJson, &storageClass); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := storageClass.Name
 			templateName = filepath.Join(templateLocation, name+".storage.yaml")
 			template, values = storageClassTemplate(storageClass)
 			values.MergeInto(valueFile, generateSafeKey(name))
-		} else if objMeta.Kind == "HorizontalPodAutoscaler" {
+		} else if kind == "HorizontalPodAutoscaler" && objMeta.APIVersion != "autoscaling/v1" {
+			hpa := horizontalPodAutoscalerV2{}
+			if err := json.Unmarshal(kubeJson, &hpa); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := hpa.Name
+			templateName = filepath.Join(templateLocation, name+".hpa.yaml")
+			template, values = horizontalPodAutoscalerV2Template(hpa)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "HorizontalPodAutoscaler" {
 			podAutoscaler := v1.HorizontalPodAutoscaler{}
 			if err := json.Unmarshal(kubeJson, &podAutoscaler); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
 			}
 			name := podAutoscaler.Name
 			templateName = filepath.Join(templateLocation, name+".hpa.yaml")
 			template, values = horizontalPodAutoscaler(podAutoscaler)
 			values.MergeInto(valueFile, generateSafeKey(name))
 			persistence = addPersistence(persistence, values.persistence)
+		} else if kind == "Ingress" {
+			ing := ingress{}
+			if err := json.Unmarshal(kubeJson, &ing); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := ing.Name
+			templateName = filepath.Join(templateLocation, name+".ingress.yaml")
+			template, values = ingressTemplate(ing)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "NetworkPolicy" {
+			np := networkPolicy{}
+			if err := json.Unmarshal(kubeJson, &np); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := np.Name
+			templateName = filepath.Join(templateLocation, name+".networkpolicy.yaml")
+			template, values = networkPolicyTemplate(np)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "PodDisruptionBudget" {
+			pdb := podDisruptionBudget{}
+			if err := json.Unmarshal(kubeJson, &pdb); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := pdb.Name
+			templateName = filepath.Join(templateLocation, name+".pdb.yaml")
+			template, values = podDisruptionBudgetTemplate(pdb)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "ServiceAccount" {
+			sa := apiv1.ServiceAccount{}
+			if err := json.Unmarshal(kubeJson, &sa); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := sa.Name
+			templateName = filepath.Join(templateLocation, name+".serviceaccount.yaml")
+			template, values = serviceAccountTemplate(sa)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "Role" {
+			role := rbac.Role{}
+			if err := json.Unmarshal(kubeJson, &role); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := role.Name
+			templateName = filepath.Join(templateLocation, name+".role.yaml")
+			template, values = roleTemplate(role)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "RoleBinding" {
+			binding := rbac.RoleBinding{}
+			if err := json.Unmarshal(kubeJson, &binding); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := binding.Name
+			templateName = filepath.Join(templateLocation, name+".rolebinding.yaml")
+			template, values = roleBindingTemplate(binding)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "ClusterRole" {
+			role := clusterRole{}
+			if err := json.Unmarshal(kubeJson, &role); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := role.Name
+			templateName = filepath.Join(templateLocation, name+".clusterrole.yaml")
+			template, values = clusterRoleTemplate(role)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "ClusterRoleBinding" {
+			binding := rbac.ClusterRoleBinding{}
+			if err := json.Unmarshal(kubeJson, &binding); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := binding.Name
+			templateName = filepath.Join(templateLocation, name+".clusterrolebinding.yaml")
+			template, values = clusterRoleBindingTemplate(binding)
+			values.MergeInto(valueFile, generateSafeKey(name))
+		} else if kind == "CustomResourceDefinition" {
+			crd := objectHeader{}
+			if err := json.Unmarshal(kubeJson, &crd); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			if g.CRDInstallHook {
+				templateName = filepath.Join(templateLocation, crd.Name+".crd.yaml")
+			} else {
+				crdLocation := filepath.Join(cdir, CRDsDir)
+				if err := os.MkdirAll(crdLocation, 0755); err != nil {
+					log.Fatal(err)
+				}
+				templateName = filepath.Join(crdLocation, crd.Name+".yaml")
+			}
+			template = crdTemplate(kubeJson, g.CRDInstallHook)
+		} else if isCustomResource(objMeta) {
+			cr := objectHeader{}
+			if err := json.Unmarshal(kubeJson, &cr); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			name := cr.Name
+			templateName = filepath.Join(templateLocation, name+"."+strings.ToLower(objMeta.Kind)+".yaml")
+			template, values = customResourceTemplate(kubeJson)
+			values.MergeInto(valueFile, generateSafeKey(name))
 		} else {
-			fmt.Printf("%v is not supported. Please add manually. Consider filing bug here: https://github.com/kubepack/chartify/issues", objMeta.Kind)
+			header := objectHeader{}
+			if err := json.Unmarshal(kubeJson, &header); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			if len(header.Kind) == 0 || len(header.Name) == 0 {
+				fmt.Printf("%s: object without kind or name is skipped\n", g.sourceOf(i))
+				continue
+			}
+			name := header.Name
+			templateName = filepath.Join(templateLocation, name+"."+strings.ToLower(header.Kind)+".yaml")
+			template, values = passthroughTemplate(kubeJson)
+			values.MergeInto(valueFile, generateSafeKey(name))
+			passedThrough = append(passedThrough, fmt.Sprintf("%s %s (%s)", header.Kind, name, g.sourceOf(i)))
+		}
+		if _, ok := typedFields[kind]; ok {
+			header := objectHeader{}
+			if err := json.Unmarshal(kubeJson, &header); err != nil {
+				log.Fatalf("%s: %v", g.sourceOf(i), err)
+			}
+			template = addUnknownFields(template, kubeJson, kind, values.value)
+			// Merged again for the values of fields newer than the vendored types.
+			values.MergeInto(valueFile, generateSafeKey(header.Name))
 		}
+		template = applyKubeVersion(template, objMeta)
+		template = applyKubeVersionToReferences(template)
 		if err := ioutil.WriteFile(templateName, []byte(template), 0644); err != nil {
 			log.Fatal(err)
 		}
@@ -228,10 +433,29 @@ func (g Generator) Create() (string, error) {
 	if err := ioutil.WriteFile(valueDir, []byte(valueFileData), 0644); err != nil {
 		log.Fatal(err)
 	}
+	if len(passedThrough) != 0 {
+		fmt.Printf("WARNING: %d object(s) of unknown kinds were added without parameterization, only their name, namespace and labels are templated:\n", len(passedThrough))
+		for _, obj := range passedThrough {
+			fmt.Println("  " + obj)
+		}
+	}
+	if len(unserved) != 0 {
+		fmt.Printf("WARNING: %d object(s) were skipped, no Kubernetes version from 1.%d to 1.%d serves them:\n", len(unserved), TargetKubeVersion.Min, TargetKubeVersion.Max)
+		for _, obj := range unserved {
+			fmt.Println("  " + obj)
+		}
+	}
 	fmt.Println("CREATE : SUCCESSFUL")
 	return cdir, nil
 }
 
+func (g Generator) sourceOf(i int) string {
+	if i < len(g.Sources) {
+		return g.Sources[i].String()
+	}
+	return fmt.Sprintf("object %d", i)
+}
+
 func cleanUpObjectMeta(m *metav1.ObjectMeta) {
 	var t metav1.Time
 	m.GenerateName = ""
@@ -244,13 +468,12 @@ func cleanUpObjectMeta(m *metav1.ObjectMeta) {
 }
 
 func cleanUpDecorators(m map[string]string) {
-	delete(m, "controller-uid")
-	delete(m, "deployment.kubernetes.io/desired-replicas")
-	delete(m, "deployment.kubernetes.io/max-replicas")
-	delete(m, "deployment.kubernetes.io/revision")
-	delete(m, "pod-template-hash")
-	delete(m, "pv.kubernetes.io/bind-completed")
-	delete(m, "pv.kubernetes.io/bound-by-controller")
+	for _, k := range DefaultSanitizeRules.Annotations {
+		delete(m, k)
+	}
+	for _, k := range DefaultSanitizeRules.Labels {
+		delete(m, k)
+	}
 }
 
 func cleanUpPodSpec(p *apiv1.PodSpec) {
@@ -288,12 +511,14 @@ func podTemplate(pod apiv1.Pod) (string, valueFileGenerator) {
 		log.Fatal(err)
 	}
 	tempPod := removeEmptyFields(string(tempPodByte))
+	tempPod = addPodSpecFields(tempPod, key, pod.Spec, value, "spec")
 	template := ""
 	if len(volumes) != 0 {
 		template = addVolumeToTemplateForPod(string(tempPod), volumes)
 	} else {
 		template = string(tempPod)
 	}
+	template = addExtraValues(template, key, pod.Spec, value, "spec")
 	data := valueFileGenerator{
 		value:       value,
 		persistence: persistence,
@@ -320,6 +545,7 @@ func replicationControllerTemplate(rc apiv1.ReplicationController) (string, valu
 		log.Fatal(err)
 	}
 	tempRc := removeEmptyFields(string(tempRcByte))
+	tempRc = addPodSpecFields(tempRc, key, rc.Spec.Template.Spec, value, "spec", "template", "spec")
 
 	tempRc, value = generateTemplateReplicationCtrSpec(rc.Spec, tempRc, key, value)
 
@@ -329,6 +555,7 @@ func replicationControllerTemplate(rc apiv1.ReplicationController) (string, valu
 	} else {
 		template = tempRc
 	}
+	template = addExtraValues(template, key, rc.Spec.Template.Spec, value, "spec", "template", "spec")
 	return template, valueFileGenerator{value: value, persistence: persistence}
 }
 
@@ -354,6 +581,7 @@ func replicaSetTemplate(replicaSet extensions.ReplicaSet) (string, valueFileGene
 		log.Fatal(err)
 	}
 	tempReplicaSet := removeEmptyFields(string(tempRcSetByte))
+	tempReplicaSet = addPodSpecFields(tempReplicaSet, key, replicaSet.Spec.Template.Spec, value, "spec", "template", "spec")
 
 	tempReplicaSet, value = generateTemplateReplicaSetSpec(replicaSet.Spec, tempReplicaSet, key, value)
 
@@ -362,6 +590,7 @@ func replicaSetTemplate(replicaSet extensions.ReplicaSet) (string, valueFileGene
 	} else {
 		template = tempReplicaSet
 	}
+	template = addExtraValues(template, key, replicaSet.Spec.Template.Spec, value, "spec", "template", "spec")
 	return template, valueFileGenerator{
 		value:       value,
 		persistence: persistence,
@@ -400,6 +629,7 @@ func deploymentTemplate(deployment extensions.Deployment) (string, valueFileGene
 		log.Fatal(err)
 	}
 	tempDeployment := removeEmptyFields(string(tempDeploymentByte))
+	tempDeployment = addPodSpecFields(tempDeployment, key, deployment.Spec.Template.Spec, value, "spec", "template", "spec")
 
 	tempDeployment, value = generateTemplateDeplymentSpec(deployment.Spec, tempDeployment, key, value)
 
@@ -408,6 +638,7 @@ func deploymentTemplate(deployment extensions.Deployment) (string, valueFileGene
 	} else {
 		template = tempDeployment
 	}
+	template = addExtraValues(template, key, deployment.Spec.Template.Spec, value, "spec", "template", "spec")
 
 	return template, valueFileGenerator{value: value, persistence: persistence}
 }
@@ -437,15 +668,17 @@ func daemonsetTemplate(daemonset extensions.DaemonSet) (string, valueFileGenerat
 		log.Fatal(err)
 	}
 	tempDaemonSet := removeEmptyFields(string(tempDaemonSetByte))
+	tempDaemonSet = addPodSpecFields(tempDaemonSet, key, daemonset.Spec.Template.Spec, value, "spec", "template", "spec")
 	if len(volumes) != 0 {
 		template = addVolumeToTemplate(tempDaemonSet, volumes)
 	} else {
 		template = tempDaemonSet
 	}
+	template = addExtraValues(template, key, daemonset.Spec.Template.Spec, value, "spec", "template", "spec")
 	return template, valueFileGenerator{value: value, persistence: persistence}
 }
 
-func statefulsetTemplate(statefulset apps.StatefulSet) (string, valueFileGenerator) {
+func statefulsetTemplate(statefulset statefulSet) (string, valueFileGenerator) {
 	cleanUpObjectMeta(&statefulset.ObjectMeta)
 	cleanUpPodSpec(&statefulset.Spec.Template.Spec)
 	volumes := ""
@@ -453,10 +686,18 @@ func statefulsetTemplate(statefulset apps.StatefulSet) (string, valueFileGenerat
 	persistence := make(map[string]interface{}, 0)
 	key := generateSafeKey(statefulset.ObjectMeta.Name)
 	statefulset.ObjectMeta = generateObjectMetaTemplate(statefulset.ObjectMeta, key, value, statefulset.ObjectMeta.Name)
-	if len(statefulset.Spec.ServiceName) != 0 {
+	if !PreserveName && checkIfNameExist(statefulset.Spec.ServiceName, "Service") {
+		// The headless Service is part of the chart, follow its templated name.
+		statefulset.Spec.ServiceName = fmt.Sprintf(`{{ template "fullname" . }}-%s`, statefulset.Spec.ServiceName)
+	} else if len(statefulset.Spec.ServiceName) != 0 {
 		value[ServiceName] = statefulset.Spec.ServiceName //generateTemplateForSingleValue(statefulset.Spec.ServiceName, "ServiceName", value)
 		statefulset.Spec.ServiceName = fmt.Sprintf("{{.Values.%s.%s}}", key, ServiceName)
 	}
+	value[PodManagementPolicy], value[UpdateStrategy] = statefulSetStrategyValues(statefulset.APIVersion, statefulset.Spec)
+	statefulset.Spec.PodManagementPolicy = ""
+	statefulset.Spec.UpdateStrategy = nil
+	claims := statefulset.Spec.VolumeClaimTemplates
+	statefulset.Spec.VolumeClaimTemplates = nil
 	statefulset.Spec.Template.Spec = generateTemplateForPodSpec(statefulset.Spec.Template.Spec, key, value)
 	if statefulset.Spec.Selector != nil {
 		modifyLabelSelector(statefulset.Spec.Selector, statefulset.Spec.Template.Labels, statefulset.ObjectMeta.Labels)
@@ -470,12 +711,20 @@ func statefulsetTemplate(statefulset apps.StatefulSet) (string, valueFileGenerat
 		log.Fatal(err)
 	}
 	tempStatefulSet := removeEmptyFields(string(tempStatefulSetByte))
+	tempStatefulSet = addPodSpecFields(tempStatefulSet, key, statefulset.Spec.Template.Spec, value, "spec", "template", "spec")
 	template := ""
 	if len(volumes) != 0 {
 		template = addVolumeToTemplate(tempStatefulSet, volumes)
 	} else {
 		template = tempStatefulSet
 	}
+	template = addExtraValues(template, key, statefulset.Spec.Template.Spec, value, "spec", "template", "spec")
+	template = insertAt(template, statefulSetStrategyTemplate(key), "spec")
+	if len(claims) != 0 {
+		claimTemplates, claimPersistence := volumeClaimTemplatesTemplate(claims)
+		template = insertAt(template, claimTemplates, "spec")
+		persistence = addPersistence(persistence, claimPersistence)
+	}
 	return template, valueFileGenerator{value: value, persistence: persistence}
 }
 
@@ -504,26 +753,88 @@ func jobTemplate(job batch.Job) (string, valueFileGenerator) {
 		log.Fatal(err)
 	}
 	tempJob := removeEmptyFields(string(tempJobByte))
+	tempJob = addPodSpecFields(tempJob, key, job.Spec.Template.Spec, value, "spec", "template", "spec")
 	template := ""
 	if len(volumes) != 0 {
 		template = addVolumeToTemplate(tempJob, volumes)
 	} else {
 		template = tempJob
 	}
+	template = addExtraValues(template, key, job.Spec.Template.Spec, value, "spec", "template", "spec")
 	return template, valueFileGenerator{value: value, persistence: persistence}
 
 }
 
+func cronJobTemplate(cronJob batchv2.CronJob) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&cronJob.ObjectMeta)
+	jobSpec := &cronJob.Spec.JobTemplate.Spec
+	cleanUpPodSpec(&jobSpec.Template.Spec)
+	cleanUpDecorators(cronJob.ObjectMeta.Labels)
+	cleanUpDecorators(cronJob.Spec.JobTemplate.Labels)
+	cleanUpDecorators(jobSpec.Template.Labels)
+	volumes := ""
+	persistence := make(map[string]interface{}, 0)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(cronJob.ObjectMeta.Name)
+	cronJob.ObjectMeta = generateObjectMetaTemplate(cronJob.ObjectMeta, key, value, cronJob.ObjectMeta.Name)
+
+	value[Schedule] = cronJob.Spec.Schedule
+	cronJob.Spec.Schedule = fmt.Sprintf("{{.Values.%s.%s}}", key, Schedule)
+	if len(cronJob.Spec.ConcurrencyPolicy) == 0 {
+		cronJob.Spec.ConcurrencyPolicy = batchv2.AllowConcurrent
+	}
+	value[ConcurrencyPolicy] = cronJob.Spec.ConcurrencyPolicy
+	cronJob.Spec.ConcurrencyPolicy = batchv2.ConcurrencyPolicy(fmt.Sprintf("{{.Values.%s.%s}}", key, ConcurrencyPolicy))
+	// suspend is always a value, a placeholder keeps the line when it is false.
+	suspend := cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+	value[Suspend] = suspend
+	placeholder := true
+	cronJob.Spec.Suspend = &placeholder
+
+	jobSpec.Template.Spec = generateTemplateForPodSpec(jobSpec.Template.Spec, key, value)
+	if len(jobSpec.Template.Spec.Volumes) != 0 {
+		volumes, persistence = generateTemplateForVolume(jobSpec.Template.Spec.Volumes, key, value)
+		value[Persistence] = true
+		jobSpec.Template.Spec.Volumes = nil
+	}
+	if jobSpec.Selector != nil {
+		cleanUpDecorators(jobSpec.Selector.MatchLabels)
+		modifyLabelSelector(jobSpec.Selector, jobSpec.Template.Labels, cronJob.ObjectMeta.Labels)
+	}
+	tempCronJobByte, err := ylib.Marshal(cronJob)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tempCronJob := removeEmptyFields(string(tempCronJobByte))
+	tempCronJob = addPodSpecFields(tempCronJob, key, cronJob.Spec.JobTemplate.Spec.Template.Spec, value, "spec", "jobTemplate", "spec", "template", "spec")
+	tempCronJob, value = generateTemplateForCronJobSpec(cronJob.Spec, tempCronJob, key, value)
+	template := ""
+	if len(volumes) != 0 {
+		template = addVolumeAt(tempCronJob, volumes, "spec", "jobTemplate", "spec", "template", "spec")
+	} else {
+		template = tempCronJob
+	}
+	template = addExtraValues(template, key, cronJob.Spec.JobTemplate.Spec.Template.Spec, value, "spec", "jobTemplate", "spec", "template", "spec")
+	return template, valueFileGenerator{value: value, persistence: persistence}
+}
+
 func serviceTemplate(svc apiv1.Service) (string, valueFileGenerator) {
 	cleanUpObjectMeta(&svc.ObjectMeta)
 	value := make(map[string]interface{}, 0)
-	key := generateSafeKey(svc.ObjectMeta.Name)
-	svc.ObjectMeta = generateObjectMetaTemplate(svc.ObjectMeta, key, value, svc.ObjectMeta.Name)
+	name := svc.ObjectMeta.Name
+	key := generateSafeKey(name)
+	svc.ObjectMeta = generateObjectMetaTemplate(svc.ObjectMeta, key, value, name)
 	ip := net.ParseIP(svc.Spec.ClusterIP)
 	if ip != nil {
 		svc.Spec.ClusterIP = ""
 	}
-	svc.Spec = generateServiceSpecTemplate(svc.Spec, key, value)
+	value[Annotations] = svc.Annotations
+	if svc.Annotations == nil {
+		value[Annotations] = map[string]string{}
+	}
+	svc.Annotations = nil
+	ports := svc.Spec.Ports
+	svc.Spec = generateServiceSpecTemplate(svc.Spec, name, key, value)
 	if svc.Spec.Selector != nil {
 		svc.Spec.Selector = modifySvcLabelSelector(svc.Spec.Selector)
 	}
@@ -532,6 +843,11 @@ func serviceTemplate(svc apiv1.Service) (string, valueFileGenerator) {
 		log.Fatal(err)
 	}
 	service := removeEmptyFields(string(svcData))
+	service = insertAt(service, fmt.Sprintf(`{{- with .Values.%s.%s }}
+%s: {{- toYaml . | nindent 4 }}
+{{- end }}
+`, key, Annotations, Annotations), "metadata")
+	service = insertAt(service, serviceSpecTemplate(key, name, ports), "spec")
 	return string(service), valueFileGenerator{value: value}
 }
 
@@ -562,15 +878,10 @@ func secretTemplate(secret apiv1.Secret) (string, valueFileGenerator) {
 	secret.ObjectMeta = generateObjectMetaTemplate(secret.ObjectMeta, key, value, secret.ObjectMeta.Name)
 	if len(secret.Data) != 0 {
 		for k, v := range secret.Data {
-			if strings.HasPrefix(k, ".") {
-				// For values that starts with ".", the Values string get populated with ".." - error for helm
-				kmod := strings.Replace(k, ".", "", 1)
-				value[kmod] = v
-				secretDataMap[k] = (fmt.Sprintf("{{.Values.%s.%s}}", key, kmod))
-			} else {
-				value[k] = v
-				secretDataMap[k] = (fmt.Sprintf("{{.Values.%s.%s}}", key, k))
-			}
+			// For values that starts with ".", the Values string get populated with ".." - error for helm
+			kmod := strings.TrimPrefix(k, ".")
+			value[kmod] = v
+			secretDataMap[k] = secretValue(key, kmod)
 		}
 	}
 	secret.Data = nil
@@ -581,7 +892,7 @@ func secretTemplate(secret apiv1.Secret) (string, valueFileGenerator) {
 		log.Fatal(err)
 	}
 	secretData := removeEmptyFields(string(secretDataByte))
-	secretData = addSecretData(secretData, secretDataMap, key)
+	secretData = addSecretData(secretData, secretDataMap)
 	return secretData, valueFileGenerator{value: value}
 }
 
@@ -661,22 +972,31 @@ func storageClassTemplate(storageClass storage.StorageClass) (string, valueFileG
 	return string(storageData), valueFileGenerator{value: value}
 }
 
-func addSecretData(secretData string, secretDataMap map[string]interface{}, key string) string {
+// secretValue returns the value of the data key dataKey of the Secret key. Keys that aren't
+// identifiers, like tls.crt, are looked up with index.
+func secretValue(key string, dataKey string) string {
+	if identifier.MatchString(dataKey) {
+		return fmt.Sprintf(".Values.%s.%s", key, dataKey)
+	}
+	return fmt.Sprintf("index .Values.%s %q", key, dataKey)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func addSecretData(secretData string, secretDataMap map[string]interface{}) string {
 	elseCondition := "{{ else }}"
 	elseAction := "{{ randAlphaNum 10 | b64enc | quote }}"
 	end := "{{ end }}"
 	data := ""
-	for k, v := range secretDataMap {
-		if strings.HasPrefix(k, ".") {
-			// For values that starts with ".", the Values string get populated with ".." - error for helm
-			kmod := strings.Replace(k, ".", "", 1)
-			ifCondition := fmt.Sprintf("{{ if .Values.%s.%s }}", key, kmod)
-			data += fmt.Sprintf("  %s\n  %s: %s\n  %s\n  %s: %s\n  %s\n", ifCondition, k, v, elseCondition, k, elseAction, end)
-		} else {
-			ifCondition := fmt.Sprintf("{{ if .Values.%s.%s }}", key, k)
-			data += fmt.Sprintf("  %s\n  %s: %s\n  %s\n  %s: %s\n  %s\n", ifCondition, k, v, elseCondition, k, elseAction, end)
-		}
-
+	keys := make([]string, 0, len(secretDataMap))
+	for k := range secretDataMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := secretDataMap[k]
+		ifCondition := fmt.Sprintf("{{ if %s }}", v)
+		data += fmt.Sprintf("  %s\n  %s: {{%s}}\n  %s\n  %s: %s\n  %s\n", ifCondition, k, v, elseCondition, k, elseAction, end)
 	}
 	dataOfSecret := "data:" + "\n" + data
 	return (secretData + dataOfSecret)
@@ -748,21 +1068,95 @@ func getObjectKindAndName(yamlData string) (string, string) {
 }
 
 func modifyLabelSelector(selector *metav1.LabelSelector, templateLabels map[string]string, metaLabels map[string]string) {
-	if len(selector.MatchLabels) == 0 {
+	for _, k := range releaseLabelKeys(selector.MatchLabels, templateLabels, metaLabels) {
+		selector.MatchLabels[k] = "{{.Release.Name}}-" + selector.MatchLabels[k]
+		templateLabels[k] = selector.MatchLabels[k]
+		metaLabels[k] = selector.MatchLabels[k]
+	}
+}
+
+// releaseLabelKeys returns the keys of matchLabels that modifyLabelSelector prefixes with the release name.
+func releaseLabelKeys(matchLabels, templateLabels, metaLabels map[string]string) []string {
+	var keys []string
+	for k := range matchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var releaseKeys []string
+	for _, k := range keys {
+		if _, ok := templateLabels[k]; !ok {
+			continue
+		}
+		if _, ok := metaLabels[k]; !ok {
+			break
+		}
+		releaseKeys = append(releaseKeys, k)
+	}
+	return releaseKeys
+}
+
+// getReleaseLabels returns the pod labels, as key=value, that the workloads among objects prefix with
+// the release name, so that other selectors of the chart can follow them.
+func getReleaseLabels(objects []string, rules SanitizeRules) map[string]bool {
+	labels := make(map[string]bool)
+	for _, v := range objects {
+		kubeJson, err := yaml.ToJSON([]byte(v))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if kubeJson, err = rules.SanitizeJSON(kubeJson); err != nil {
+			log.Fatal(err)
+		}
+		if TargetKubeVersion.isSet() {
+			kubeJson = defaultSelector(kubeJson)
+		}
+		var workload struct {
+			metav1.TypeMeta   `json:",inline"`
+			metav1.ObjectMeta `json:"metadata,omitempty"`
+			Spec              struct {
+				Selector *metav1.LabelSelector `json:"selector,omitempty"`
+				Template apiv1.PodTemplateSpec `json:"template,omitempty"`
+			} `json:"spec,omitempty"`
+		}
+		if err := json.Unmarshal(kubeJson, &workload); err != nil {
+			log.Fatal(err)
+		}
+		switch workload.Kind {
+		case "Deployment", "ReplicaSet", "DaemonSet", "StatefulSet", "Job":
+		default:
+			continue
+		}
+		selector := workload.Spec.Selector
+		if selector == nil {
+			continue
+		}
+		metaLabels := generateTemplateForLables(workload.Labels)
+		for _, k := range releaseLabelKeys(selector.MatchLabels, workload.Spec.Template.Labels, metaLabels) {
+			labels[k+"="+selector.MatchLabels[k]] = true
+		}
+	}
+	return labels
+}
+
+// modifyPodSelector prefixes the labels of selector that the workloads of the chart prefix with the release name.
+func modifyPodSelector(selector *metav1.LabelSelector) {
+	if selector == nil {
 		return
 	}
 	for k, v := range selector.MatchLabels {
-		_, ok := templateLabels[k]
-		if !ok {
+		if ReleaseLabels[k+"="+v] {
+			selector.MatchLabels[k] = "{{.Release.Name}}-" + v
+		}
+	}
+	for i, req := range selector.MatchExpressions {
+		if req.Operator != metav1.LabelSelectorOpIn && req.Operator != metav1.LabelSelectorOpNotIn {
 			continue
 		}
-		_, ok = metaLabels[k]
-		if !ok {
-			return
+		for j, v := range req.Values {
+			if ReleaseLabels[req.Key+"="+v] {
+				selector.MatchExpressions[i].Values[j] = "{{.Release.Name}}-" + v
+			}
 		}
-		selector.MatchLabels[k] = "{{.Release.Name}}-" + v
-		templateLabels[k] = selector.MatchLabels[k]
-		metaLabels[k] = selector.MatchLabels[k]
 	}
 }
 
@@ -784,20 +1178,3 @@ func cleanupForReplicaSets(rcSet *extensions.ReplicaSet) {
 	cleanUpDecorators(rcSet.Spec.Selector.MatchLabels)
 	cleanUpDecorators(rcSet.Spec.Template.ObjectMeta.Labels)
 }
-
-func ReadLocalFiles(dirName string) []string {
-	var yamlFiles []string
-	files, err := ioutil.ReadDir(dirName)
-	if err != nil {
-		log.Fatal(err)
-	}
-	for _, f := range files {
-		fileDir := filepath.Join(dirName, f.Name())
-		dataByte, err := ioutil.ReadFile(fileDir)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
-	}
-	return yamlFiles
-}
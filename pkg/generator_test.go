@@ -8,11 +8,13 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
-	apps "k8s.io/client-go/pkg/apis/apps/v1beta1"
 	v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
 	batch "k8s.io/client-go/pkg/apis/batch/v1"
+	batchv2 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
 	storage "k8s.io/client-go/pkg/apis/storage/v1"
 )
 
@@ -173,16 +175,32 @@ func TestStorageClassTemplate(t *testing.T) {
 }
 
 func TestStatefulsetTemplate(t *testing.T) {
-	yamlFile, err := ioutil.ReadFile("../testdata/statefulset/input/statefulset.yaml")
-	assert.Nil(t, err)
-	statefulset := apps.StatefulSet{}
-	err = yaml.Unmarshal(yamlFile, &statefulset)
-	assert.Nil(t, err)
-	template, values := statefulsetTemplate(statefulset)
-	expectedTemplate, err := ioutil.ReadFile("../testdata/statefulset/output/statefulset_chart.yaml")
+	ChartObject = map[string][]string{"Service": {"db-headless"}}
+	defer func() { ChartObject = nil }()
+	for _, name := range []string{"statefulset", "statefulset_claims"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/statefulset/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		statefulset := statefulSet{}
+		err = yaml.Unmarshal(yamlFile, &statefulset)
+		assert.Nil(t, err)
+		template, values := statefulsetTemplate(statefulset)
+		expectedTemplate, err := ioutil.ReadFile("../testdata/statefulset/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), string(template))
+		valueChecker(t, "../testdata/statefulset/output/"+name+"_value.yaml", values.value)
+		valueChecker(t, "../testdata/statefulset/output/"+name+"_persistence.yaml", values.persistence)
+	}
+}
+
+func TestChartForStatefulsets(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/statefulset/input", FileFilter{})
 	assert.Nil(t, err)
-	assert.Equal(t, string(expectedTemplate), string(template))
-	valueChecker(t, "../testdata/statefulset/output/statefulset_value.yaml", values.value)
+	g := Generator{
+		ChartName: "test",
+		YamlFiles: yamlFiles,
+		Sources:   sources,
+	}
+	chartChecker(t, g, "../testdata/statefulset/output_chart")
 }
 
 func TestServiceTemplateWithClusterIP(t *testing.T) {
@@ -199,13 +217,15 @@ func TestServiceTemplateWithClusterIP(t *testing.T) {
 }
 
 func TestChartForVolume(t *testing.T) {
-	yamlFiles := ReadLocalFiles("../testdata/mix_objects/check_volume/input")
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/check_volume/input", FileFilter{})
+	assert.Nil(t, err)
 	tmp, err := ioutil.TempDir(os.TempDir(), "test")
 	defer os.Remove(tmp)
 	assert.Nil(t, err)
 	g := Generator{
 		ChartName: "test",
 		YamlFiles: yamlFiles,
+		Sources:   sources,
 		Location:  tmp,
 	}
 	chdir, err := g.Create()
@@ -271,6 +291,23 @@ func TestHorizontalPodAutoscalerTemplate(t *testing.T) {
 	valueChecker(t, "../testdata/hpa/output/hpa_value.yaml", values.value)
 }
 
+func TestIngressTemplate(t *testing.T) {
+	ChartObject = map[string][]string{"Service": {"web"}}
+	defer func() { ChartObject = nil }()
+	for _, name := range []string{"ingress", "ingress_v1beta1"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/ingress/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		ing := ingress{}
+		err = yaml.Unmarshal(yamlFile, &ing)
+		assert.Nil(t, err)
+		template, values := ingressTemplate(ing)
+		expectedTemplate, err := ioutil.ReadFile("../testdata/ingress/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), string(template))
+		valueChecker(t, "../testdata/ingress/output/"+name+"_value.yaml", values.value)
+	}
+}
+
 func valueChecker(t *testing.T, expectedPath string, value map[string]interface{}) {
 	valuesInfo, err := yaml.Marshal(value)
 	assert.Nil(t, err)
@@ -278,3 +315,284 @@ func valueChecker(t *testing.T, expectedPath string, value map[string]interface{
 	assert.Nil(t, err)
 	assert.Equal(t, string(expectedValues), string(valuesInfo))
 }
+
+// chartChecker creates the chart of g in a temporary directory and compares its crds, templates and
+// values.yaml with those in expectedDir.
+func chartChecker(t *testing.T, g Generator, expectedDir string) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	g.Location = tmp
+	chdir, err := g.Create()
+	assert.Nil(t, err)
+	for _, dir := range []string{CRDsDir, TemplatesDir} {
+		files, _ := ioutil.ReadDir(filepath.Join(expectedDir, dir))
+		actualFiles, _ := ioutil.ReadDir(filepath.Join(chdir, dir))
+		if dir == TemplatesDir {
+			// _helpers.tpl is always written.
+			assert.Equal(t, len(files)+1, len(actualFiles), expectedDir)
+		} else {
+			assert.Equal(t, len(files), len(actualFiles), expectedDir)
+		}
+		for _, v := range files {
+			actualData, err := ioutil.ReadFile(filepath.Join(chdir, dir, v.Name()))
+			assert.Nil(t, err)
+			expectedData, err := ioutil.ReadFile(filepath.Join(expectedDir, dir, v.Name()))
+			assert.Nil(t, err)
+			assert.Equal(t, string(expectedData), string(actualData), v.Name())
+		}
+	}
+	actualValues, err := ioutil.ReadFile(filepath.Join(chdir, ValuesfileName))
+	assert.Nil(t, err)
+	expectedValues, err := ioutil.ReadFile(filepath.Join(expectedDir, ValuesfileName))
+	assert.Nil(t, err)
+	assert.Equal(t, string(expectedValues), string(actualValues), expectedDir)
+}
+
+func TestRBACTemplates(t *testing.T) {
+	templates := map[string]func(data []byte) (string, valueFileGenerator){
+		"serviceaccount": func(data []byte) (string, valueFileGenerator) {
+			sa := apiv1.ServiceAccount{}
+			assert.Nil(t, yaml.Unmarshal(data, &sa))
+			return serviceAccountTemplate(sa)
+		},
+		"role": func(data []byte) (string, valueFileGenerator) {
+			role := rbac.Role{}
+			assert.Nil(t, yaml.Unmarshal(data, &role))
+			return roleTemplate(role)
+		},
+		"rolebinding": func(data []byte) (string, valueFileGenerator) {
+			binding := rbac.RoleBinding{}
+			assert.Nil(t, yaml.Unmarshal(data, &binding))
+			return roleBindingTemplate(binding)
+		},
+		"clusterrole": func(data []byte) (string, valueFileGenerator) {
+			role := clusterRole{}
+			assert.Nil(t, yaml.Unmarshal(data, &role))
+			return clusterRoleTemplate(role)
+		},
+		"clusterrolebinding": func(data []byte) (string, valueFileGenerator) {
+			binding := rbac.ClusterRoleBinding{}
+			assert.Nil(t, yaml.Unmarshal(data, &binding))
+			return clusterRoleBindingTemplate(binding)
+		},
+		"deployment": func(data []byte) (string, valueFileGenerator) {
+			deployment := extensions.Deployment{}
+			assert.Nil(t, yaml.Unmarshal(data, &deployment))
+			return deploymentTemplate(deployment)
+		},
+	}
+	inputs := map[string]string{}
+	var objects []string
+	for name := range templates {
+		data, err := ioutil.ReadFile("../testdata/rbac/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		inputs[name] = string(data)
+		objects = append(objects, string(data))
+	}
+	ChartObject = getInsideObjects(objects)
+	defer func() { ChartObject = nil }()
+	for name, template := range templates {
+		actual, values := template([]byte(inputs[name]))
+		expectedTemplate, err := ioutil.ReadFile("../testdata/rbac/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), actual, name)
+		valueChecker(t, "../testdata/rbac/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestCronJobTemplate(t *testing.T) {
+	for _, name := range []string{"cronjob", "cronjob_v1beta1"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/cronjob/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		cronJob := batchv2.CronJob{}
+		err = yaml.Unmarshal(yamlFile, &cronJob)
+		assert.Nil(t, err)
+		template, values := cronJobTemplate(cronJob)
+		expectedTemplate, err := ioutil.ReadFile("../testdata/cronjob/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), string(template), name)
+		valueChecker(t, "../testdata/cronjob/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestPolicyTemplates(t *testing.T) {
+	var objects []string
+	for _, name := range []string{"deployment", "networkpolicy", "pdb", "pdb_v1beta1"} {
+		data, err := ioutil.ReadFile("../testdata/policy/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		objects = append(objects, string(data))
+	}
+	ReleaseLabels = getReleaseLabels(objects, DefaultSanitizeRules)
+	defer func() { ReleaseLabels = nil }()
+	for _, name := range []string{"networkpolicy", "pdb", "pdb_v1beta1"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/policy/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		var template string
+		var values valueFileGenerator
+		if name == "networkpolicy" {
+			np := networkPolicy{}
+			assert.Nil(t, yaml.Unmarshal(yamlFile, &np))
+			template, values = networkPolicyTemplate(np)
+		} else {
+			pdb := podDisruptionBudget{}
+			assert.Nil(t, yaml.Unmarshal(yamlFile, &pdb))
+			template, values = podDisruptionBudgetTemplate(pdb)
+		}
+		expectedTemplate, err := ioutil.ReadFile("../testdata/policy/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), template, name)
+		valueChecker(t, "../testdata/policy/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestChartForCustomResources(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/custom_resources/input", FileFilter{})
+	assert.Nil(t, err)
+	for _, hook := range []bool{false, true} {
+		g := Generator{
+			ChartName:      "test",
+			YamlFiles:      yamlFiles,
+			Sources:        sources,
+			CRDInstallHook: hook,
+		}
+		expectedDir := "../testdata/mix_objects/custom_resources/output"
+		if hook {
+			expectedDir = "../testdata/mix_objects/custom_resources/output_hook"
+		}
+		chartChecker(t, g, expectedDir)
+	}
+}
+
+func TestPassthroughTemplate(t *testing.T) {
+	for _, name := range []string{"endpoints", "limitrange", "resourcequota", "priorityclass", "podtemplate"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/passthrough/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		objJson, err := yaml.YAMLToJSON(yamlFile)
+		assert.Nil(t, err)
+		template, values := passthroughTemplate(objJson)
+		expectedTemplate, err := ioutil.ReadFile("../testdata/passthrough/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), template, name)
+		valueChecker(t, "../testdata/passthrough/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestModernVersions(t *testing.T) {
+	assert.Equal(t, "StatefulSet", handledKind(metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"}))
+	assert.Equal(t, "StatefulSet", handledKind(metav1.TypeMeta{APIVersion: "apps/v1alpha1", Kind: "StatefulSet"}))
+	assert.Equal(t, "", handledKind(metav1.TypeMeta{APIVersion: "extensions/v1beta1", Kind: "StatefulSet"}))
+	assert.Equal(t, "ConfigMap", handledKind(metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}))
+
+	for _, name := range []string{"statefulset", "hpa_v2", "hpa_v2beta1"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/versions/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		kubeJson, err := yaml.YAMLToJSON(yamlFile)
+		assert.Nil(t, err)
+		kubeJson, err = DefaultSanitizeRules.SanitizeJSON(kubeJson)
+		assert.Nil(t, err)
+		var template string
+		var values valueFileGenerator
+		if name == "statefulset" {
+			statefulset := statefulSet{}
+			assert.Nil(t, yaml.Unmarshal(kubeJson, &statefulset))
+			template, values = statefulsetTemplate(statefulset)
+			template = addUnknownFields(template, kubeJson, "StatefulSet", values.value)
+		} else {
+			hpa := horizontalPodAutoscalerV2{}
+			assert.Nil(t, yaml.Unmarshal(kubeJson, &hpa))
+			template, values = horizontalPodAutoscalerV2Template(hpa)
+		}
+		expectedTemplate, err := ioutil.ReadFile("../testdata/versions/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), template, name)
+		valueChecker(t, "../testdata/versions/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestContainerFields(t *testing.T) {
+	for _, name := range []string{"deployment", "init_containers"} {
+		yamlFile, err := ioutil.ReadFile("../testdata/container_fields/input/" + name + ".yaml")
+		assert.Nil(t, err)
+		kubeJson, err := yaml.YAMLToJSON(yamlFile)
+		assert.Nil(t, err)
+		deployment := extensions.Deployment{}
+		assert.Nil(t, yaml.Unmarshal(kubeJson, &deployment))
+		template, values := deploymentTemplate(deployment)
+		template = addUnknownFields(template, kubeJson, "Deployment", values.value)
+		expectedTemplate, err := ioutil.ReadFile("../testdata/container_fields/output/" + name + "_chart.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expectedTemplate), template, name)
+		valueChecker(t, "../testdata/container_fields/output/"+name+"_value.yaml", values.value)
+	}
+}
+
+func TestScheduling(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/scheduling/input", FileFilter{})
+	assert.Nil(t, err)
+	g := Generator{
+		ChartName: "test",
+		YamlFiles: yamlFiles,
+		Sources:   sources,
+	}
+	chartChecker(t, g, "../testdata/mix_objects/scheduling/output")
+}
+
+func TestServicePorts(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/service_ports/input", FileFilter{})
+	assert.Nil(t, err)
+	g := Generator{
+		ChartName: "test",
+		YamlFiles: yamlFiles,
+		Sources:   sources,
+	}
+	chartChecker(t, g, "../testdata/mix_objects/service_ports/output")
+}
+
+func TestKubeVersion(t *testing.T) {
+	r, err := ParseKubeVersionRange("1.16-v1.25.3")
+	assert.Nil(t, err)
+	assert.Equal(t, KubeVersionRange{Min: 16, Max: 25}, r)
+	r, err = ParseKubeVersionRange("1.22")
+	assert.Nil(t, err)
+	assert.Equal(t, KubeVersionRange{Min: 22, Max: 22}, r)
+	_, err = ParseKubeVersionRange("1.25-1.16")
+	assert.NotNil(t, err)
+	defer func() { TargetKubeVersion = KubeVersionRange{} }()
+	psp := metav1.TypeMeta{APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy"}
+	assert.True(t, KubeVersionRange{Min: 16, Max: 25}.serves(psp))
+	assert.False(t, KubeVersionRange{Min: 25, Max: 26}.serves(psp))
+	TargetKubeVersion = KubeVersionRange{Min: 16, Max: 25}
+	assert.Equal(t, "spec:\n  jobRef:\n    apiVersion: "+
+		`{{ if semverCompare ">=1.21-0" $.Capabilities.KubeVersion.GitVersion }}batch/v1{{ else }}batch/v1beta1{{ end }}`+
+		"\n    kind: CronJob\n    name: cleanup\n",
+		applyKubeVersionToReferences("spec:\n  jobRef:\n    apiVersion: batch/v1beta1\n    kind: CronJob\n    name: cleanup\n"))
+
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/kube_version/input", FileFilter{})
+	assert.Nil(t, err)
+	g := Generator{
+		ChartName:   "test",
+		YamlFiles:   yamlFiles,
+		Sources:     sources,
+		KubeVersion: KubeVersionRange{Min: 16, Max: 25},
+	}
+	chartChecker(t, g, "../testdata/mix_objects/kube_version/output")
+}
+
+func TestWebhookConfigurations(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/mix_objects/webhook/input", FileFilter{})
+	assert.Nil(t, err)
+	for _, gen := range []bool{false, true} {
+		g := Generator{
+			ChartName:       "test",
+			YamlFiles:       yamlFiles,
+			Sources:         sources,
+			GenWebhookCerts: gen,
+		}
+		expectedDir := "../testdata/mix_objects/webhook/output"
+		if gen {
+			expectedDir = "../testdata/mix_objects/webhook/output_gen"
+		}
+		chartChecker(t, g, expectedDir)
+	}
+}
@@ -0,0 +1,253 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ingress holds the fields of an extensions/v1beta1, networking.k8s.io/v1beta1 or
+// networking.k8s.io/v1 Ingress.
+type ingress struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ingressSpec `json:"spec,omitempty"`
+}
+
+type ingressSpec struct {
+	IngressClassName string          `json:"ingressClassName,omitempty"`
+	Backend          *ingressBackend `json:"backend,omitempty"`
+	DefaultBackend   *ingressBackend `json:"defaultBackend,omitempty"`
+	TLS              []ingressTLS    `json:"tls,omitempty"`
+	Rules            []ingressRule   `json:"rules,omitempty"`
+}
+
+type ingressTLS struct {
+	Hosts      []string `json:"hosts,omitempty"`
+	SecretName string   `json:"secretName,omitempty"`
+}
+
+type ingressRule struct {
+	Host string `json:"host,omitempty"`
+	HTTP *struct {
+		Paths []ingressPath `json:"paths"`
+	} `json:"http,omitempty"`
+}
+
+type ingressPath struct {
+	Path     string         `json:"path,omitempty"`
+	PathType string         `json:"pathType,omitempty"`
+	Backend  ingressBackend `json:"backend"`
+}
+
+type ingressBackend struct {
+	// v1beta1
+	ServiceName string              `json:"serviceName,omitempty"`
+	ServicePort *intstr.IntOrString `json:"servicePort,omitempty"`
+	// v1
+	Service *struct {
+		Name string `json:"name"`
+		Port struct {
+			Name   string `json:"name,omitempty"`
+			Number int32  `json:"number,omitempty"`
+		} `json:"port"`
+	} `json:"service,omitempty"`
+}
+
+const networkingV1 = "networking.k8s.io/v1"
+
+// values returns the backend as serviceName and servicePort, the port being a number or a name.
+func (b ingressBackend) values() (map[string]interface{}, bool) {
+	value := make(map[string]interface{}, 0)
+	if b.Service != nil {
+		value["serviceName"] = b.Service.Name
+		if len(b.Service.Port.Name) != 0 {
+			value["servicePort"] = b.Service.Port.Name
+		} else {
+			value["servicePort"] = b.Service.Port.Number
+		}
+		return value, true
+	}
+	if len(b.ServiceName) == 0 {
+		return nil, false
+	}
+	value["serviceName"] = b.ServiceName
+	if b.ServicePort != nil {
+		if b.ServicePort.Type == intstr.String {
+			value["servicePort"] = b.ServicePort.StrVal
+		} else {
+			value["servicePort"] = b.ServicePort.IntVal
+		}
+	}
+	return value, true
+}
+
+func ingressTemplate(ing ingress) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&ing.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(ing.ObjectMeta.Name)
+	// Only enabled is kept under ingress, hosts, tls and the rest are values of the key itself.
+	values := fmt.Sprintf(".Values.%s", key)
+	value[Ingress] = map[string]interface{}{
+		Enabled: true,
+	}
+	value[ClassName] = ing.Spec.IngressClassName
+	if len(ing.Annotations) != 0 {
+		value[Annotations] = ing.Annotations
+	}
+	ing.Annotations = nil
+
+	backend := ing.Spec.DefaultBackend
+	if backend == nil {
+		backend = ing.Spec.Backend
+	}
+	if backend != nil {
+		if v, ok := backend.values(); ok {
+			value[DefaultBackend] = v
+		}
+	}
+
+	// v1 is chosen by the target Kubernetes versions, if any, otherwise by the Ingress' own version.
+	// v1Condition is set if only part of them serve v1.
+	v1Condition, isV1 := TargetKubeVersion.sinceCondition(ing.TypeMeta, networkingV1)
+	// pathType is only known from 1.18 on.
+	pathTypeCondition := ".pathType"
+	if TargetKubeVersion.isSet() && TargetKubeVersion.Min < 18 {
+		pathTypeCondition = fmt.Sprintf("and .pathType (%s)", kubeVersionCondition(">=1.18-0"))
+	}
+
+	var hosts []interface{}
+	for _, rule := range ing.Spec.Rules {
+		var paths []interface{}
+		if rule.HTTP != nil {
+			for _, p := range rule.HTTP.Paths {
+				v, ok := p.Backend.values()
+				if !ok {
+					fmt.Printf("Ingress %s: only service backends are supported, skipping path %q\n", ing.Name, p.Path)
+					continue
+				}
+				if len(p.Path) != 0 {
+					v["path"] = p.Path
+				}
+				if len(p.PathType) != 0 {
+					v["pathType"] = p.PathType
+				} else if isV1 && ing.APIVersion != networkingV1 {
+					// pathType is required by v1.
+					v["pathType"] = "ImplementationSpecific"
+				}
+				paths = append(paths, v)
+			}
+		}
+		hosts = append(hosts, map[string]interface{}{"host": rule.Host, "paths": paths})
+	}
+	value[Hosts] = hosts
+
+	var tls []interface{}
+	for _, t := range ing.Spec.TLS {
+		tls = append(tls, map[string]interface{}{"hosts": t.Hosts, "secretName": t.SecretName})
+	}
+	if len(tls) != 0 {
+		value[TLS] = tls
+	}
+
+	ing.ObjectMeta = generateObjectMetaTemplate(ing.ObjectMeta, key, value, ing.ObjectMeta.Name)
+	header, err := ylib.Marshal(struct {
+		metav1.TypeMeta `json:",inline"`
+		Metadata        metav1.ObjectMeta `json:"metadata"`
+	}{ing.TypeMeta, ing.ObjectMeta})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{{- if %s.%s.%s -}}\n", values, Ingress, Enabled)
+	buf.WriteString(removeEmptyFields(string(header)))
+	fmt.Fprintf(&buf, "  {{- with %s.%s }}\n", values, Annotations)
+	buf.WriteString("  annotations:\n{{ toYaml . | indent 4 }}\n  {{- end }}\n")
+	buf.WriteString("spec:\n")
+	fmt.Fprintf(&buf, "  {{- if %s.%s }}\n", values, ClassName)
+	fmt.Fprintf(&buf, "  ingressClassName: {{ %s.%s }}\n", values, ClassName)
+	buf.WriteString("  {{- end }}\n")
+
+	fmt.Fprintf(&buf, "  {{- with %s.%s }}\n", values, DefaultBackend)
+	buf.WriteString(ingressVersionTemplate(v1Condition, isV1, "  ", "  defaultBackend:\n", "  backend:\n"))
+	buf.WriteString(ingressVersionTemplate(v1Condition, isV1, "    ", ingressBackendTemplate(true, "    "), ingressBackendTemplate(false, "    ")))
+	buf.WriteString("  {{- end }}\n")
+
+	fmt.Fprintf(&buf, "  {{- if %s.%s }}\n", values, TLS)
+	buf.WriteString("  tls:\n")
+	fmt.Fprintf(&buf, "  {{- range %s.%s }}\n", values, TLS)
+	buf.WriteString(`  - hosts:
+    {{- range .hosts }}
+    - {{ . | quote }}
+    {{- end }}
+    secretName: {{ .secretName }}
+  {{- end }}
+  {{- end }}
+`)
+
+	buf.WriteString("  rules:\n")
+	fmt.Fprintf(&buf, "  {{- range %s.%s }}\n", values, Hosts)
+	buf.WriteString(`  - {{- if .host }}
+    host: {{ .host | quote }}
+    {{- end }}
+    http:
+      paths:
+      {{- range .paths }}
+      - {{- if .path }}
+        path: {{ .path }}
+        {{- end }}
+        {{- if ` + pathTypeCondition + ` }}
+        pathType: {{ .pathType }}
+        {{- end }}
+        backend:
+`)
+	buf.WriteString(ingressVersionTemplate(v1Condition, isV1, "          ", ingressBackendTemplate(true, "          "), ingressBackendTemplate(false, "          ")))
+	buf.WriteString("      {{- end }}\n  {{- end }}\n{{- end }}\n")
+
+	return buf.String(), valueFileGenerator{value: value}
+}
+
+// ingressVersionTemplate returns v1 or v1beta1, or both switched on v1Condition if it is set.
+func ingressVersionTemplate(v1Condition string, isV1 bool, indent, v1, v1beta1 string) string {
+	if len(v1Condition) != 0 {
+		return indent + "{{- if " + v1Condition + " }}\n" + v1 +
+			indent + "{{- else }}\n" + v1beta1 +
+			indent + "{{- end }}\n"
+	}
+	if isV1 {
+		return v1
+	}
+	return v1beta1
+}
+
+// ingressBackendTemplate renders the serviceName and servicePort of the backend in dot. Services of
+// the chart are renamed to their templated fullname.
+func ingressBackendTemplate(isV1 bool, indent string) string {
+	serviceName := "{{ .serviceName }}"
+	if !PreserveName && len(ChartObject["Service"]) != 0 {
+		var names []string
+		for _, name := range ChartObject["Service"] {
+			names = append(names, strconv.Quote(name))
+		}
+		serviceName = fmt.Sprintf(`{{ if has .serviceName (list %s) }}{{ template "fullname" $ }}-{{ end }}{{ .serviceName }}`, strings.Join(names, " "))
+	}
+	if !isV1 {
+		return indent + "serviceName: " + serviceName + "\n" +
+			indent + "servicePort: {{ .servicePort }}\n"
+	}
+	return indent + "service:\n" +
+		indent + "  name: " + serviceName + "\n" +
+		indent + "  port:\n" +
+		indent + "    {{- if kindIs \"string\" .servicePort }}\n" +
+		indent + "    name: {{ .servicePort }}\n" +
+		indent + "    {{- else }}\n" +
+		indent + "    number: {{ .servicePort }}\n" +
+		indent + "    {{- end }}\n"
+}
@@ -2,18 +2,20 @@ package pkg
 
 import (
 	"fmt"
-	"log"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/ghodss/yaml"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clientset "k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/pkg/api"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	apps "k8s.io/client-go/pkg/apis/apps/v1beta1"
+	autoscaling "k8s.io/client-go/pkg/apis/autoscaling/v1"
 	batch "k8s.io/client-go/pkg/apis/batch/v1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	storage "k8s.io/client-go/pkg/apis/storage/v1"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -32,473 +34,730 @@ type KubeObjects struct {
 	StatefulSets             []string
 	StorageClasses           []string
 	HorizontalPodAutoscalers []string
+	ServiceAccounts          []string
+	// Resources holds objects of any kind known to the cluster as kind/name@namespace,
+	// or just a kind to select every object of it with Selector.
+	Resources []string
+
+	// Namespace is searched when objects are selected with Selector or AllInNamespace.
+	Namespace string
+	// Selector selects objects of every supported kind by label.
+	Selector string
+	// AllInNamespace selects every object of a supported kind in Namespace.
+	AllInNamespace bool
+	// WithDependencies adds the objects referenced by the selected workloads.
+	WithDependencies bool
+	// Concurrency limits the number of objects read from the cluster at the same time.
+	Concurrency int
 }
 
-func (ko KubeObjects) Extract() []string {
-	kubeClient, err := newKubeClient()
-	if err != nil {
-		log.Fatal(err)
+// ClusterConfig selects the kubeconfig, context and credentials used to connect to a cluster.
+// Empty fields fall back to the current context of the default kubeconfig.
+type ClusterConfig struct {
+	Kubeconfig            string
+	Context               string
+	Cluster               string
+	User                  string
+	As                    string
+	AsGroups              []string
+	RequestTimeout        string
+	InsecureSkipTLSVerify bool
+	// QPS and Burst rate limit the requests to the cluster. Zero uses the client-go defaults.
+	QPS   float32
+	Burst int
+}
+
+// ObjectError is the failure to read a single object from the cluster.
+type ObjectError struct {
+	Kind string
+	// Name is the object as given, i.e. name@namespace.
+	Name string
+	Err  error
+}
+
+func (e ObjectError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Kind, e.Name, e.Err)
+}
+
+// ExtractErrors collects the objects that could not be read by Extract.
+type ExtractErrors []ObjectError
+
+func (errs ExtractErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
 	}
-	yamlFiles := ko.readKubernetesObjects(kubeClient)
-	return yamlFiles
+	return fmt.Sprintf("failed to read %d object(s):\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+func (errs ExtractErrors) orNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Extract reads the objects named in ko through kubeClient and returns them as yaml.
+// Objects that can not be read don't stop the extraction. They are returned as
+// ExtractErrors along with the objects that were read.
+func (ko KubeObjects) Extract(kubeClient clientset.Interface) ([]string, error) {
+	if len(ko.Selector) != 0 || ko.AllInNamespace {
+		if err := ko.selectObjects(kubeClient); err != nil {
+			return nil, err
+		}
+	}
+	if ko.WithDependencies {
+		graph, err := ko.resolveDependencies(kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Resolved dependencies:")
+		fmt.Print(graph)
+	}
+	return ko.readKubernetesObjects(kubeClient)
 }
 
 func (ko KubeObjects) CheckFlags() bool {
+	if len(ko.Selector) != 0 || ko.AllInNamespace {
+		return true
+	}
 	v := reflect.ValueOf(ko)
 	for i := 0; i < v.NumField(); i++ {
-		if v.Field(i).Len() > 0 {
+		if v.Field(i).Kind() == reflect.Slice && v.Field(i).Len() > 0 {
 			return true
 		}
 	}
 	return false
 }
 
-func (ko KubeObjects) readKubernetesObjects(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	if len(ko.Pods) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getPods(kubeClient))
+type selectedObject struct {
+	meta  metav1.ObjectMeta
+	names *[]string
+}
+
+// selectObjects lists every supported kind in ko.Namespace that matches ko.Selector and adds
+// the objects to the name lists of ko. Cluster scoped kinds are only listed with a selector.
+// Objects owned by another selected object (e.g. Pods of a ReplicaSet of a Deployment) are
+// skipped, since their owner creates them.
+func (ko *KubeObjects) selectObjects(kubeClient clientset.Interface) error {
+	namespace := ko.Namespace
+	if len(namespace) == 0 {
+		namespace = apiv1.NamespaceDefault
 	}
-	if len(ko.Services) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getServices(kubeClient))
+	opts := metav1.ListOptions{LabelSelector: ko.Selector}
+	var objects []selectedObject
+	add := func(meta metav1.ObjectMeta, names *[]string) {
+		objects = append(objects, selectedObject{meta: meta, names: names})
 	}
-	if len(ko.ReplicationControllers) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getReplicationControllers(kubeClient))
+
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	if len(ko.Secrets) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getSecrets(kubeClient))
+	for _, v := range pods.Items {
+		add(v.ObjectMeta, &ko.Pods)
 	}
-	if len(ko.ConfigMaps) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getConfigMaps(kubeClient))
+	services, err := kubeClient.CoreV1().Services(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range services.Items {
+		if v.Namespace == apiv1.NamespaceDefault && v.Name == "kubernetes" {
+			continue
+		}
+		add(v.ObjectMeta, &ko.Services)
 	}
-	if len(ko.StatefulSets) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getStatefulSets(kubeClient))
+	rcs, err := kubeClient.CoreV1().ReplicationControllers(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	if len(ko.PersistentVolumes) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getPersistentVolumes(kubeClient))
+	for _, v := range rcs.Items {
+		add(v.ObjectMeta, &ko.ReplicationControllers)
 	}
-	if len(ko.PersistentVolumeClaims) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getPersistentVolumeClaims(kubeClient))
+	secrets, err := kubeClient.CoreV1().Secrets(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	if len(ko.Jobs) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getJobs(kubeClient))
+	for _, v := range secrets.Items {
+		if v.Type == apiv1.SecretTypeServiceAccountToken {
+			continue
+		}
+		add(v.ObjectMeta, &ko.Secrets)
 	}
-	if len(ko.Daemons) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getDaemons(kubeClient))
+	configMaps, err := kubeClient.CoreV1().ConfigMaps(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	if len(ko.Deployments) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getDeployments(kubeClient))
+	for _, v := range configMaps.Items {
+		add(v.ObjectMeta, &ko.ConfigMaps)
 	}
-	if len(ko.ReplicaSets) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getReplicaSets(kubeClient))
+	statefulSets, err := kubeClient.AppsV1beta1().StatefulSets(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	if len(ko.StorageClasses) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getStorageClasses(kubeClient))
+	for _, v := range statefulSets.Items {
+		add(v.ObjectMeta, &ko.StatefulSets)
 	}
-	if len(ko.HorizontalPodAutoscalers) != 0 {
-		yamlFiles = appendSlice(yamlFiles, ko.getHorizontalPodAutoscalers(kubeClient))
+	pvcs, err := kubeClient.CoreV1().PersistentVolumeClaims(namespace).List(opts)
+	if err != nil {
+		return err
 	}
-	return yamlFiles
-}
-
-func (ko KubeObjects) getPods(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.Pods {
-		objectName, namespace := splitNamespace(v)
-		pod, err := kubeClient.CoreV1().Pods(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
+	for _, v := range pvcs.Items {
+		add(v.ObjectMeta, &ko.PersistentVolumeClaims)
+	}
+	jobs, err := kubeClient.BatchV1().Jobs(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range jobs.Items {
+		add(v.ObjectMeta, &ko.Jobs)
+	}
+	daemons, err := kubeClient.ExtensionsV1beta1().DaemonSets(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range daemons.Items {
+		add(v.ObjectMeta, &ko.Daemons)
+	}
+	deployments, err := kubeClient.ExtensionsV1beta1().Deployments(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range deployments.Items {
+		add(v.ObjectMeta, &ko.Deployments)
+	}
+	replicaSets, err := kubeClient.ExtensionsV1beta1().ReplicaSets(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range replicaSets.Items {
+		add(v.ObjectMeta, &ko.ReplicaSets)
+	}
+	hpas, err := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range hpas.Items {
+		add(v.ObjectMeta, &ko.HorizontalPodAutoscalers)
+	}
+	serviceAccounts, err := kubeClient.CoreV1().ServiceAccounts(namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range serviceAccounts.Items {
+		if v.Name == "default" {
+			continue
 		}
-		ref, err := apiv1.GetReference(api.Scheme, pod)
+		add(v.ObjectMeta, &ko.ServiceAccounts)
+	}
+	if len(ko.Selector) != 0 {
+		pvs, err := kubeClient.CoreV1().PersistentVolumes().List(opts)
 		if err != nil {
-			log.Fatal(err)
-		}
-		if pod.Kind == "" {
-			pod.Kind = ref.Kind
+			return err
 		}
-		if pod.APIVersion == "" {
-			pod.APIVersion = ref.APIVersion
+		for _, v := range pvs.Items {
+			add(v.ObjectMeta, &ko.PersistentVolumes)
 		}
-		pod.Status = apiv1.PodStatus{}
-		dataByte, err := yaml.Marshal(pod)
+		storageClasses, err := kubeClient.StorageV1().StorageClasses().List(opts)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		for _, v := range storageClasses.Items {
+			add(v.ObjectMeta, &ko.StorageClasses)
 		}
-		yamlFiles = append(yamlFiles, string(dataByte))
 	}
-	return yamlFiles
-}
 
-func (ko KubeObjects) getReplicationControllers(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.ReplicationControllers {
-		objectName, namespace := splitNamespace(v)
-		rc, err := kubeClient.CoreV1().ReplicationControllers(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, rc)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if rc.Kind == "" {
-			rc.Kind = ref.Kind
+	uids := sets.NewString()
+	for _, o := range objects {
+		uids.Insert(string(o.meta.UID))
+	}
+	for _, o := range objects {
+		if isOwnedByAny(o.meta, uids) {
+			continue
 		}
-		if rc.APIVersion == "" {
-			rc.APIVersion = ref.APIVersion
+		name := o.meta.Name
+		if len(o.meta.Namespace) != 0 {
+			name = name + "@" + o.meta.Namespace
 		}
-		rc.Status = apiv1.ReplicationControllerStatus{}
-		dataByte, err := yaml.Marshal(rc)
-		if err != nil {
-			log.Fatal(err)
+		if !sets.NewString(*o.names...).Has(name) {
+			*o.names = append(*o.names, name)
 		}
-		yamlFiles = append(yamlFiles, string(dataByte))
 	}
-	return yamlFiles
+	return nil
 }
 
-func (ko KubeObjects) getServices(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.Services {
-		objectName, namespace := splitNamespace(v)
-		service, err := kubeClient.CoreV1().Services(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, service)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if service.Kind == "" {
-			service.Kind = ref.Kind
-		}
-		if service.APIVersion == "" {
-			service.APIVersion = ref.APIVersion
-		}
-		service.Status = apiv1.ServiceStatus{}
-		dataByte, err := yaml.Marshal(service)
-		if err != nil {
-			log.Fatal(err)
+func isOwnedByAny(meta metav1.ObjectMeta, uids sets.String) bool {
+	for _, ref := range meta.OwnerReferences {
+		if uids.Has(string(ref.UID)) {
+			return true
 		}
-		yamlFiles = append(yamlFiles, string(dataByte))
 	}
-	return yamlFiles
+	return false
 }
 
-func (ko KubeObjects) getSecrets(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.Secrets {
-		objectName, namespace := splitNamespace(v)
-		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, secret)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if secret.Kind == "" {
-			secret.Kind = ref.Kind
-		}
-		if secret.APIVersion == "" {
-			secret.APIVersion = ref.APIVersion
-		}
-		dataByte, err := yaml.Marshal(secret)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
-	}
-	return yamlFiles
+// fetch reads a single object, or several for a kind given with --resource.
+type fetch struct {
+	kind string
+	name string
+	get  func() ([]string, error)
 }
 
-func (ko KubeObjects) getConfigMaps(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.ConfigMaps {
-		objectName, namespace := splitNamespace(v)
-		configmap, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, configmap)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if configmap.Kind == "" {
-			configmap.Kind = ref.Kind
-		}
-		if configmap.APIVersion == "" {
-			configmap.APIVersion = ref.APIVersion
-		}
-		dataByte, err := yaml.Marshal(configmap)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
+// fetches lists the reads of every named object in the order their yaml is returned.
+func (ko KubeObjects) fetches(kubeClient clientset.Interface) []fetch {
+	getters := []struct {
+		kind  string
+		names []string
+		get   func(clientset.Interface, string) (string, error)
+	}{
+		{"Pod", ko.Pods, getPod},
+		{"Service", ko.Services, getService},
+		{"ReplicationController", ko.ReplicationControllers, getReplicationController},
+		{"Secret", ko.Secrets, getSecret},
+		{"ConfigMap", ko.ConfigMaps, getConfigMap},
+		{"StatefulSet", ko.StatefulSets, getStatefulSet},
+		{"PersistentVolume", ko.PersistentVolumes, getPersistentVolume},
+		{"PersistentVolumeClaim", ko.PersistentVolumeClaims, getPersistentVolumeClaim},
+		{"Job", ko.Jobs, getJob},
+		{"DaemonSet", ko.Daemons, getDaemonSet},
+		{"Deployment", ko.Deployments, getDeployment},
+		{"ReplicaSet", ko.ReplicaSets, getReplicaSet},
+		{"StorageClass", ko.StorageClasses, getStorageClass},
+		{"HorizontalPodAutoscaler", ko.HorizontalPodAutoscalers, getHorizontalPodAutoscaler},
+		{"ServiceAccount", ko.ServiceAccounts, getServiceAccount},
+	}
+	var fetches []fetch
+	for _, g := range getters {
+		for _, v := range g.names {
+			get, name := g.get, v
+			fetches = append(fetches, fetch{kind: g.kind, name: v, get: func() ([]string, error) {
+				file, err := get(kubeClient, name)
+				if err != nil {
+					return nil, err
+				}
+				return []string{file}, nil
+			}})
+		}
+	}
+	if len(ko.Resources) == 0 {
+		return fetches
+	}
+	// The resources of the server are discovered once for every --resource.
+	resourceLists, discoveryErr := serverResources(kubeClient.Discovery())
+	for _, v := range ko.Resources {
+		kind, objectName, namespace := splitResource(v, ko.Namespace)
+		fetches = append(fetches, fetch{kind: kind, name: v, get: func() ([]string, error) {
+			if len(objectName) == 0 && len(ko.Selector) == 0 && !ko.AllInNamespace {
+				return nil, fmt.Errorf("give a name, --selector or --all-in-namespace to read objects of %s", kind)
+			}
+			if discoveryErr != nil {
+				return nil, discoveryErr
+			}
+			return getResource(kubeClient.Discovery(), resourceLists, kind, objectName, namespace, ko.Selector)
+		}})
 	}
-	return yamlFiles
+	return fetches
 }
 
-func (ko KubeObjects) getStatefulSets(kubeClient clientset.Interface) []string {
+// readKubernetesObjects runs up to ko.Concurrency fetches at a time. The yaml is returned
+// in the order of fetches, no matter when each fetch finishes.
+func (ko KubeObjects) readKubernetesObjects(kubeClient clientset.Interface) ([]string, error) {
+	fetches := ko.fetches(kubeClient)
+	results := make([][]string, len(fetches))
+	failures := make([]error, len(fetches))
+
+	concurrency := ko.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range fetches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], failures[i] = fetches[i].get()
+		}(i)
+	}
+	wg.Wait()
+
 	var yamlFiles []string
-	for _, v := range ko.StatefulSets {
-		objectName, namespace := splitNamespace(v)
-		statefulset, err := kubeClient.AppsV1beta1().StatefulSets(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, statefulset)
-		if err != nil {
-			log.Fatal(err)
+	var errs ExtractErrors
+	for i, f := range fetches {
+		if failures[i] != nil {
+			errs = append(errs, ObjectError{Kind: f.kind, Name: f.name, Err: failures[i]})
+			continue
 		}
-		if statefulset.Kind == "" {
-			statefulset.Kind = ref.Kind
-		}
-		if len(statefulset.APIVersion) == 0 {
-			statefulset.APIVersion = makeAPIVersion(statefulset.GetSelfLink())
-		}
-		statefulset.Status = apps.StatefulSetStatus{}
-		dataByte, err := yaml.Marshal(statefulset)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
+		yamlFiles = appendSlice(yamlFiles, results[i])
 	}
-	return yamlFiles
+	return yamlFiles, errs.orNil()
 }
 
-func (ko KubeObjects) getPersistentVolumes(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.PersistentVolumes {
-		pv, err := kubeClient.CoreV1().PersistentVolumes().Get(v, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, pv)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if pv.Kind == "" {
-			pv.Kind = ref.Kind
-		}
-		if pv.APIVersion == "" {
-			pv.APIVersion = ref.APIVersion
-		}
-		dataByte, err := yaml.Marshal(pv)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
+func getPod(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pod.Kind == "" {
+		pod.Kind = "Pod"
+	}
+	if pod.APIVersion == "" {
+		pod.APIVersion = apiv1.SchemeGroupVersion.String()
 	}
-	return yamlFiles
+	pod.Status = apiv1.PodStatus{}
+	dataByte, err := yaml.Marshal(pod)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getPersistentVolumeClaims(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.PersistentVolumeClaims {
-		objectName, namespace := splitNamespace(v)
-		pvc, err := kubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, pvc)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if pvc.Kind == "" {
-			pvc.Kind = ref.Kind
-		}
-		if pvc.APIVersion == "" {
-			pvc.APIVersion = ref.APIVersion
-		}
-		dataByte, err := yaml.Marshal(pvc)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
+func getReplicationController(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	rc, err := kubeClient.CoreV1().ReplicationControllers(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if rc.Kind == "" {
+		rc.Kind = "ReplicationController"
+	}
+	if rc.APIVersion == "" {
+		rc.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	rc.Status = apiv1.ReplicationControllerStatus{}
+	dataByte, err := yaml.Marshal(rc)
+	if err != nil {
+		return "", err
 	}
-	return yamlFiles
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getJobs(kubeClient clientset.Interface) []string {
-	var jobFiles []string
-	for _, v := range ko.Jobs {
-		objectName, namespace := splitNamespace(v)
-		job, err := kubeClient.BatchV1().Jobs(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, job)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if job.Kind == "" {
-			job.Kind = ref.Kind
-		}
-		if job.APIVersion == "" {
-			job.APIVersion = makeAPIVersion(job.GetSelfLink())
-		}
-		job.Status = batch.JobStatus{}
-		dataByte, err := yaml.Marshal(job)
-		if err != nil {
-			log.Fatal(err)
-		}
-		jobFiles = append(jobFiles, string(dataByte))
+func getService(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
 	}
-	return jobFiles
+	service, err := kubeClient.CoreV1().Services(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if service.Kind == "" {
+		service.Kind = "Service"
+	}
+	if service.APIVersion == "" {
+		service.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	service.Status = apiv1.ServiceStatus{}
+	dataByte, err := yaml.Marshal(service)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getDaemons(kubeClient clientset.Interface) []string {
-	var daemonFiles []string
-	for _, v := range ko.Daemons {
-		objectName, namespace := splitNamespace(v)
-		daemon, err := kubeClient.ExtensionsV1beta1().DaemonSets(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, daemon)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if daemon.Kind == "" {
-			daemon.Kind = ref.Kind
-		}
-		if daemon.APIVersion == "" {
-			daemon.APIVersion = makeAPIVersion(daemon.GetSelfLink())
-		}
-		daemon.Status = extensions.DaemonSetStatus{}
-		dataByte, err := yaml.Marshal(daemon)
-		if err != nil {
-			log.Fatal(err)
-		}
-		daemonFiles = append(daemonFiles, string(dataByte))
-
+func getSecret(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if secret.Kind == "" {
+		secret.Kind = "Secret"
 	}
-	return daemonFiles
+	if secret.APIVersion == "" {
+		secret.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	dataByte, err := yaml.Marshal(secret)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getDeployments(kubeClient clientset.Interface) []string {
-	var files []string
-	for _, v := range ko.Deployments {
-		objectName, namespace := splitNamespace(v)
-		deployment, err := kubeClient.ExtensionsV1beta1().Deployments(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, deployment)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if deployment.Kind == "" {
-			deployment.Kind = ref.Kind
-		}
-		if deployment.APIVersion == "" {
-			deployment.APIVersion = makeAPIVersion(deployment.GetSelfLink())
-		}
-		deployment.Status = extensions.DeploymentStatus{}
-		dataByte, err := yaml.Marshal(deployment)
-		if err != nil {
-			log.Fatal(err)
-		}
-		files = append(files, string(dataByte))
-
+func getConfigMap(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
 	}
-	return files
+	configmap, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if configmap.Kind == "" {
+		configmap.Kind = "ConfigMap"
+	}
+	if configmap.APIVersion == "" {
+		configmap.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	dataByte, err := yaml.Marshal(configmap)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getReplicaSets(kubeClient clientset.Interface) []string {
-	var yamlFiles []string
-	for _, v := range ko.ReplicaSets {
-		objectName, namespace := splitNamespace(v)
-		rs, err := kubeClient.ExtensionsV1beta1().ReplicaSets(namespace).Get(objectName, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, rs)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if rs.Kind == "" {
-			rs.Kind = ref.Kind
-		}
-		if rs.APIVersion == "" {
-			rs.APIVersion = makeAPIVersion(rs.GetSelfLink())
-		}
-		rs.Status = extensions.ReplicaSetStatus{}
-		dataByte, err := yaml.Marshal(rs)
-		if err != nil {
-			log.Fatal(err)
-		}
-		yamlFiles = append(yamlFiles, string(dataByte))
+func getStatefulSet(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	statefulset, err := kubeClient.AppsV1beta1().StatefulSets(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if statefulset.Kind == "" {
+		statefulset.Kind = "StatefulSet"
 	}
-	return yamlFiles
+	if len(statefulset.APIVersion) == 0 {
+		statefulset.APIVersion = apps.SchemeGroupVersion.String()
+	}
+	statefulset.Status = apps.StatefulSetStatus{}
+	dataByte, err := yaml.Marshal(statefulset)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getStorageClasses(kubeClient clientset.Interface) []string {
-	var storageFiles []string
-	for _, v := range ko.StorageClasses {
-		//objectsName, namespace := splitnamespace(v)
-		storageClass, err := kubeClient.StorageV1().StorageClasses().Get(v, metav1.GetOptions{})
-		if err != nil {
-			log.Fatal(err)
-		}
-		ref, err := apiv1.GetReference(api.Scheme, storageClass)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if storageClass.Kind == "" {
-			storageClass.Kind = ref.Kind
-		}
-		if storageClass.APIVersion == "" {
-			storageClass.APIVersion = makeAPIVersion(storageClass.GetSelfLink())
-		}
-		dataByte, err := yaml.Marshal(storageClass)
-		if err != nil {
-			log.Fatal(err)
-		}
-		storageFiles = append(storageFiles, string(dataByte))
+func getPersistentVolume(kubeClient clientset.Interface, v string) (string, error) {
+	pv, err := kubeClient.CoreV1().PersistentVolumes().Get(v, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pv.Kind == "" {
+		pv.Kind = "PersistentVolume"
+	}
+	if pv.APIVersion == "" {
+		pv.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	dataByte, err := yaml.Marshal(pv)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
+func getPersistentVolumeClaim(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	pvc, err := kubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pvc.Kind == "" {
+		pvc.Kind = "PersistentVolumeClaim"
 	}
+	if pvc.APIVersion == "" {
+		pvc.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	dataByte, err := yaml.Marshal(pvc)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
-	return storageFiles
+func getJob(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	job, err := kubeClient.BatchV1().Jobs(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if job.Kind == "" {
+		job.Kind = "Job"
+	}
+	if job.APIVersion == "" {
+		job.APIVersion = batch.SchemeGroupVersion.String()
+	}
+	job.Status = batch.JobStatus{}
+	dataByte, err := yaml.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
+func getDaemonSet(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	daemon, err := kubeClient.ExtensionsV1beta1().DaemonSets(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if daemon.Kind == "" {
+		daemon.Kind = "DaemonSet"
+	}
+	if daemon.APIVersion == "" {
+		daemon.APIVersion = extensions.SchemeGroupVersion.String()
+	}
+	daemon.Status = extensions.DaemonSetStatus{}
+	dataByte, err := yaml.Marshal(daemon)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func (ko KubeObjects) getHorizontalPodAutoscalers(kubeClient clientset.Interface) []string {
-	var horizontalPodAutoscalers []string
-	for _, v := range ko.HorizontalPodAutoscalers {
-		_, namespace := splitNamespace(v)
-		horizontalPodAutoscaler := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(namespace)
-		scaler, _ := horizontalPodAutoscaler.List(metav1.ListOptions{})
+func getDeployment(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	deployment, err := kubeClient.ExtensionsV1beta1().Deployments(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if deployment.Kind == "" {
+		deployment.Kind = "Deployment"
+	}
+	if deployment.APIVersion == "" {
+		deployment.APIVersion = extensions.SchemeGroupVersion.String()
+	}
+	deployment.Status = extensions.DeploymentStatus{}
+	dataByte, err := yaml.Marshal(deployment)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
-		for _, item := range scaler.Items {
-			if item.Kind == "" {
-				item.Kind = "HorizontalPodAutoscaler"
-			}
+func getReplicaSet(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	rs, err := kubeClient.ExtensionsV1beta1().ReplicaSets(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if rs.Kind == "" {
+		rs.Kind = "ReplicaSet"
+	}
+	if rs.APIVersion == "" {
+		rs.APIVersion = extensions.SchemeGroupVersion.String()
+	}
+	rs.Status = extensions.ReplicaSetStatus{}
+	dataByte, err := yaml.Marshal(rs)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
-			if item.APIVersion == "" {
-				item.APIVersion = makeAPIVersion(item.GetSelfLink())
-			}
+func getStorageClass(kubeClient clientset.Interface, v string) (string, error) {
+	storageClass, err := kubeClient.StorageV1().StorageClasses().Get(v, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if storageClass.Kind == "" {
+		storageClass.Kind = "StorageClass"
+	}
+	if storageClass.APIVersion == "" {
+		storageClass.APIVersion = storage.SchemeGroupVersion.String()
+	}
+	dataByte, err := yaml.Marshal(storageClass)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
-			dataByte, err := yaml.Marshal(item)
-			if err != nil {
-				log.Fatal(err)
-			}
-			horizontalPodAutoscalers = append(horizontalPodAutoscalers, string(dataByte))
-		}
+func getHorizontalPodAutoscaler(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	hpa, err := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if hpa.Kind == "" {
+		hpa.Kind = "HorizontalPodAutoscaler"
 	}
+	if hpa.APIVersion == "" {
+		hpa.APIVersion = autoscaling.SchemeGroupVersion.String()
+	}
+	hpa.Status = autoscaling.HorizontalPodAutoscalerStatus{}
+	dataByte, err := yaml.Marshal(hpa)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
+}
 
-	return horizontalPodAutoscalers
+func getServiceAccount(kubeClient clientset.Interface, v string) (string, error) {
+	objectName, namespace, err := splitNamespace(v)
+	if err != nil {
+		return "", err
+	}
+	sa, err := kubeClient.CoreV1().ServiceAccounts(namespace).Get(objectName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if sa.Kind == "" {
+		sa.Kind = "ServiceAccount"
+	}
+	if sa.APIVersion == "" {
+		sa.APIVersion = apiv1.SchemeGroupVersion.String()
+	}
+	// Token secrets are generated by the cluster for every service account.
+	sa.Secrets = nil
+	dataByte, err := yaml.Marshal(sa)
+	if err != nil {
+		return "", err
+	}
+	return string(dataByte), nil
 }
 
-func newKubeClient() (clientset.Interface, error) {
+// NewKubeClient builds a client for the cluster selected by c. It also returns the namespace of the
+// kubeconfig context, which kubectl defaults to.
+func NewKubeClient(c ClusterConfig) (clientset.Interface, string, error) {
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
 	rules.DefaultClientConfig = &clientcmd.DefaultClientConfig
-	overrides := &clientcmd.ConfigOverrides{ClusterDefaults: clientcmd.ClusterDefaults}
-	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	rules.ExplicitPath = c.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		ClusterDefaults: clientcmd.ClusterDefaults,
+		CurrentContext:  c.Context,
+		Timeout:         c.RequestTimeout,
+	}
+	overrides.Context.Cluster = c.Cluster
+	overrides.Context.AuthInfo = c.User
+	overrides.AuthInfo.Impersonate = c.As
+	overrides.ClusterInfo.InsecureSkipTLSVerify = c.InsecureSkipTLSVerify
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not get kubernetes config: %s", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
 	if err != nil {
-		return nil, fmt.Errorf("Could not get kubernetes config: %s", err)
+		return nil, "", fmt.Errorf("Could not get kubernetes config: %s", err)
 	}
-	return clientset.NewForConfig(config)
+	if len(c.AsGroups) != 0 {
+		config.Impersonate.Groups = c.AsGroups
+	}
+	config.QPS = c.QPS
+	config.Burst = c.Burst
+	kubeClient, err := clientset.NewForConfig(config)
+	return kubeClient, namespace, err
 }
 
 func appendSlice(mainSlice []string, subSlice []string) []string {
@@ -508,22 +767,12 @@ func appendSlice(mainSlice []string, subSlice []string) []string {
 	return mainSlice
 }
 
-func splitNamespace(s string) (string, string) {
+func splitNamespace(s string) (string, string, error) {
 	str := strings.Split(s, "@")
 	if len(str) == 2 {
-		return str[0], str[1]
+		return str[0], str[1], nil
 	} else if len(str) == 1 {
-		return str[0], apiv1.NamespaceDefault
-	}
-	log.Fatal("ERROR : Can not detect Namespace")
-	return "", ""
-}
-
-func makeAPIVersion(selfLink string) string {
-	str := strings.Split(selfLink, "/")
-	if len(str) > 2 {
-		return (str[2] + "/" + str[3])
+		return str[0], apiv1.NamespaceDefault, nil
 	}
-	log.Fatal("api version not found")
-	return ""
+	return "", "", fmt.Errorf("can not detect the namespace of %s, expected name@namespace", s)
 }
@@ -0,0 +1,874 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	clientset "k8s.io/client-go/kubernetes"
+	appsv1beta1 "k8s.io/client-go/kubernetes/typed/apps/v1beta1"
+	autoscalingv1 "k8s.io/client-go/kubernetes/typed/autoscaling/v1"
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	extensionsv1beta1 "k8s.io/client-go/kubernetes/typed/extensions/v1beta1"
+	storagev1 "k8s.io/client-go/kubernetes/typed/storage/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	apps "k8s.io/client-go/pkg/apis/apps/v1beta1"
+	autoscaling "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	batch "k8s.io/client-go/pkg/apis/batch/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	storage "k8s.io/client-go/pkg/apis/storage/v1"
+)
+
+// fakeClientset serves Get and List requests of the kinds read by KubeObjects from memory.
+// Every other method of the embedded interfaces panics.
+type fakeClientset struct {
+	clientset.Interface
+	objects map[string]interface{}
+	// delays holds the latency of Get requests by object name.
+	delays map[string]time.Duration
+
+	// resources are the preferred resources served by discovery.
+	resources []*metav1.APIResourceList
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	discoveries int
+}
+
+func newFakeClientset(objects ...metav1.Object) *fakeClientset {
+	c := &fakeClientset{objects: map[string]interface{}{}}
+	for _, obj := range objects {
+		c.objects[fakeKey(obj, obj.GetNamespace(), obj.GetName())] = obj
+	}
+	return c
+}
+
+func fakeKey(obj interface{}, namespace, name string) string {
+	return fakeResource(obj) + "/" + namespace + "/" + name
+}
+
+func fakeResource(obj interface{}) string {
+	switch obj.(type) {
+	case *apiv1.Pod:
+		return "pods"
+	case *apiv1.Service:
+		return "services"
+	case *apiv1.ReplicationController:
+		return "replicationcontrollers"
+	case *apiv1.Secret:
+		return "secrets"
+	case *apiv1.ConfigMap:
+		return "configmaps"
+	case *apiv1.PersistentVolume:
+		return "persistentvolumes"
+	case *apiv1.PersistentVolumeClaim:
+		return "persistentvolumeclaims"
+	case *apiv1.ServiceAccount:
+		return "serviceaccounts"
+	case *apps.StatefulSet:
+		return "statefulsets"
+	case *batch.Job:
+		return "jobs"
+	case *extensions.DaemonSet:
+		return "daemonsets"
+	case *extensions.Deployment:
+		return "deployments"
+	case *extensions.ReplicaSet:
+		return "replicasets"
+	case *storage.StorageClass:
+		return "storageclasses"
+	case *autoscaling.HorizontalPodAutoscaler:
+		return "horizontalpodautoscalers"
+	}
+	panic("unsupported object")
+}
+
+func (c *fakeClientset) get(resource, namespace, name string) (interface{}, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	time.Sleep(c.delays[name])
+
+	obj, ok := c.objects[resource+"/"+namespace+"/"+name]
+	if !ok {
+		return nil, kerr.NewNotFound(schema.GroupResource{Resource: resource}, name)
+	}
+	return obj, nil
+}
+
+// list returns the objects of resource in namespace matching the label selector of opts, by name.
+func (c *fakeClientset) list(resource, namespace string, opts metav1.ListOptions) ([]interface{}, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for k, obj := range c.objects {
+		if strings.HasPrefix(k, resource+"/"+namespace+"/") && selector.Matches(labels.Set(obj.(metav1.Object).GetLabels())) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var objects []interface{}
+	for _, k := range keys {
+		objects = append(objects, c.objects[k])
+	}
+	return objects, nil
+}
+
+func (c *fakeClientset) Discovery() discovery.DiscoveryInterface {
+	return fakeDiscovery{c: c}
+}
+
+func (c *fakeClientset) CoreV1() corev1.CoreV1Interface {
+	return fakeCoreV1{c: c}
+}
+
+func (c *fakeClientset) AppsV1beta1() appsv1beta1.AppsV1beta1Interface {
+	return fakeAppsV1beta1{c: c}
+}
+
+func (c *fakeClientset) BatchV1() batchv1.BatchV1Interface {
+	return fakeBatchV1{c: c}
+}
+
+func (c *fakeClientset) ExtensionsV1beta1() extensionsv1beta1.ExtensionsV1beta1Interface {
+	return fakeExtensionsV1beta1{c: c}
+}
+
+func (c *fakeClientset) StorageV1() storagev1.StorageV1Interface {
+	return fakeStorageV1{c: c}
+}
+
+func (c *fakeClientset) AutoscalingV1() autoscalingv1.AutoscalingV1Interface {
+	return fakeAutoscalingV1{c: c}
+}
+
+type fakeDiscovery struct {
+	discovery.DiscoveryInterface
+	c *fakeClientset
+}
+
+func (f fakeDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	f.c.mu.Lock()
+	f.c.discoveries++
+	f.c.mu.Unlock()
+	return f.c.resources, nil
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	c *fakeClientset
+}
+
+func (f fakeCoreV1) Pods(namespace string) corev1.PodInterface {
+	return fakePods{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) Services(namespace string) corev1.ServiceInterface {
+	return fakeServices{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) ReplicationControllers(namespace string) corev1.ReplicationControllerInterface {
+	return fakeReplicationControllers{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) Secrets(namespace string) corev1.SecretInterface {
+	return fakeSecrets{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	return fakeConfigMaps{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) PersistentVolumes() corev1.PersistentVolumeInterface {
+	return fakePersistentVolumes{c: f.c}
+}
+
+func (f fakeCoreV1) PersistentVolumeClaims(namespace string) corev1.PersistentVolumeClaimInterface {
+	return fakePersistentVolumeClaims{c: f.c, ns: namespace}
+}
+
+func (f fakeCoreV1) ServiceAccounts(namespace string) corev1.ServiceAccountInterface {
+	return fakeServiceAccounts{c: f.c, ns: namespace}
+}
+
+type fakePods struct {
+	corev1.PodInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakePods) Get(name string, _ metav1.GetOptions) (*apiv1.Pod, error) {
+	obj, err := f.c.get("pods", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.Pod), nil
+}
+
+func (f fakePods) List(opts metav1.ListOptions) (*apiv1.PodList, error) {
+	objects, err := f.c.list("pods", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.PodList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.Pod))
+	}
+	return list, nil
+}
+
+type fakeServices struct {
+	corev1.ServiceInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeServices) Get(name string, _ metav1.GetOptions) (*apiv1.Service, error) {
+	obj, err := f.c.get("services", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.Service), nil
+}
+
+func (f fakeServices) List(opts metav1.ListOptions) (*apiv1.ServiceList, error) {
+	objects, err := f.c.list("services", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.ServiceList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.Service))
+	}
+	return list, nil
+}
+
+type fakeReplicationControllers struct {
+	corev1.ReplicationControllerInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeReplicationControllers) Get(name string, _ metav1.GetOptions) (*apiv1.ReplicationController, error) {
+	obj, err := f.c.get("replicationcontrollers", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.ReplicationController), nil
+}
+
+func (f fakeReplicationControllers) List(opts metav1.ListOptions) (*apiv1.ReplicationControllerList, error) {
+	objects, err := f.c.list("replicationcontrollers", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.ReplicationControllerList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.ReplicationController))
+	}
+	return list, nil
+}
+
+type fakeSecrets struct {
+	corev1.SecretInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeSecrets) Get(name string, _ metav1.GetOptions) (*apiv1.Secret, error) {
+	obj, err := f.c.get("secrets", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.Secret), nil
+}
+
+func (f fakeSecrets) List(opts metav1.ListOptions) (*apiv1.SecretList, error) {
+	objects, err := f.c.list("secrets", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.SecretList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.Secret))
+	}
+	return list, nil
+}
+
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeConfigMaps) Get(name string, _ metav1.GetOptions) (*apiv1.ConfigMap, error) {
+	obj, err := f.c.get("configmaps", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.ConfigMap), nil
+}
+
+func (f fakeConfigMaps) List(opts metav1.ListOptions) (*apiv1.ConfigMapList, error) {
+	objects, err := f.c.list("configmaps", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.ConfigMapList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.ConfigMap))
+	}
+	return list, nil
+}
+
+type fakePersistentVolumes struct {
+	corev1.PersistentVolumeInterface
+	c *fakeClientset
+}
+
+func (f fakePersistentVolumes) Get(name string, _ metav1.GetOptions) (*apiv1.PersistentVolume, error) {
+	obj, err := f.c.get("persistentvolumes", "", name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.PersistentVolume), nil
+}
+
+func (f fakePersistentVolumes) List(opts metav1.ListOptions) (*apiv1.PersistentVolumeList, error) {
+	objects, err := f.c.list("persistentvolumes", "", opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.PersistentVolumeList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.PersistentVolume))
+	}
+	return list, nil
+}
+
+type fakePersistentVolumeClaims struct {
+	corev1.PersistentVolumeClaimInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakePersistentVolumeClaims) Get(name string, _ metav1.GetOptions) (*apiv1.PersistentVolumeClaim, error) {
+	obj, err := f.c.get("persistentvolumeclaims", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.PersistentVolumeClaim), nil
+}
+
+func (f fakePersistentVolumeClaims) List(opts metav1.ListOptions) (*apiv1.PersistentVolumeClaimList, error) {
+	objects, err := f.c.list("persistentvolumeclaims", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.PersistentVolumeClaimList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.PersistentVolumeClaim))
+	}
+	return list, nil
+}
+
+type fakeServiceAccounts struct {
+	corev1.ServiceAccountInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeServiceAccounts) Get(name string, _ metav1.GetOptions) (*apiv1.ServiceAccount, error) {
+	obj, err := f.c.get("serviceaccounts", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apiv1.ServiceAccount), nil
+}
+
+func (f fakeServiceAccounts) List(opts metav1.ListOptions) (*apiv1.ServiceAccountList, error) {
+	objects, err := f.c.list("serviceaccounts", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apiv1.ServiceAccountList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apiv1.ServiceAccount))
+	}
+	return list, nil
+}
+
+type fakeAppsV1beta1 struct {
+	appsv1beta1.AppsV1beta1Interface
+	c *fakeClientset
+}
+
+func (f fakeAppsV1beta1) StatefulSets(namespace string) appsv1beta1.StatefulSetInterface {
+	return fakeStatefulSets{c: f.c, ns: namespace}
+}
+
+type fakeStatefulSets struct {
+	appsv1beta1.StatefulSetInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeStatefulSets) Get(name string, _ metav1.GetOptions) (*apps.StatefulSet, error) {
+	obj, err := f.c.get("statefulsets", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*apps.StatefulSet), nil
+}
+
+func (f fakeStatefulSets) List(opts metav1.ListOptions) (*apps.StatefulSetList, error) {
+	objects, err := f.c.list("statefulsets", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &apps.StatefulSetList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*apps.StatefulSet))
+	}
+	return list, nil
+}
+
+type fakeBatchV1 struct {
+	batchv1.BatchV1Interface
+	c *fakeClientset
+}
+
+func (f fakeBatchV1) Jobs(namespace string) batchv1.JobInterface {
+	return fakeJobs{c: f.c, ns: namespace}
+}
+
+type fakeJobs struct {
+	batchv1.JobInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeJobs) Get(name string, _ metav1.GetOptions) (*batch.Job, error) {
+	obj, err := f.c.get("jobs", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*batch.Job), nil
+}
+
+func (f fakeJobs) List(opts metav1.ListOptions) (*batch.JobList, error) {
+	objects, err := f.c.list("jobs", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &batch.JobList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*batch.Job))
+	}
+	return list, nil
+}
+
+type fakeExtensionsV1beta1 struct {
+	extensionsv1beta1.ExtensionsV1beta1Interface
+	c *fakeClientset
+}
+
+func (f fakeExtensionsV1beta1) DaemonSets(namespace string) extensionsv1beta1.DaemonSetInterface {
+	return fakeDaemonSets{c: f.c, ns: namespace}
+}
+
+func (f fakeExtensionsV1beta1) Deployments(namespace string) extensionsv1beta1.DeploymentInterface {
+	return fakeDeployments{c: f.c, ns: namespace}
+}
+
+func (f fakeExtensionsV1beta1) ReplicaSets(namespace string) extensionsv1beta1.ReplicaSetInterface {
+	return fakeReplicaSets{c: f.c, ns: namespace}
+}
+
+type fakeDaemonSets struct {
+	extensionsv1beta1.DaemonSetInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeDaemonSets) Get(name string, _ metav1.GetOptions) (*extensions.DaemonSet, error) {
+	obj, err := f.c.get("daemonsets", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*extensions.DaemonSet), nil
+}
+
+func (f fakeDaemonSets) List(opts metav1.ListOptions) (*extensions.DaemonSetList, error) {
+	objects, err := f.c.list("daemonsets", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &extensions.DaemonSetList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*extensions.DaemonSet))
+	}
+	return list, nil
+}
+
+type fakeDeployments struct {
+	extensionsv1beta1.DeploymentInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeDeployments) Get(name string, _ metav1.GetOptions) (*extensions.Deployment, error) {
+	obj, err := f.c.get("deployments", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*extensions.Deployment), nil
+}
+
+func (f fakeDeployments) List(opts metav1.ListOptions) (*extensions.DeploymentList, error) {
+	objects, err := f.c.list("deployments", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &extensions.DeploymentList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*extensions.Deployment))
+	}
+	return list, nil
+}
+
+type fakeReplicaSets struct {
+	extensionsv1beta1.ReplicaSetInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeReplicaSets) Get(name string, _ metav1.GetOptions) (*extensions.ReplicaSet, error) {
+	obj, err := f.c.get("replicasets", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*extensions.ReplicaSet), nil
+}
+
+func (f fakeReplicaSets) List(opts metav1.ListOptions) (*extensions.ReplicaSetList, error) {
+	objects, err := f.c.list("replicasets", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &extensions.ReplicaSetList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*extensions.ReplicaSet))
+	}
+	return list, nil
+}
+
+type fakeStorageV1 struct {
+	storagev1.StorageV1Interface
+	c *fakeClientset
+}
+
+func (f fakeStorageV1) StorageClasses() storagev1.StorageClassInterface {
+	return fakeStorageClasses{c: f.c}
+}
+
+type fakeStorageClasses struct {
+	storagev1.StorageClassInterface
+	c *fakeClientset
+}
+
+func (f fakeStorageClasses) Get(name string, _ metav1.GetOptions) (*storage.StorageClass, error) {
+	obj, err := f.c.get("storageclasses", "", name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*storage.StorageClass), nil
+}
+
+func (f fakeStorageClasses) List(opts metav1.ListOptions) (*storage.StorageClassList, error) {
+	objects, err := f.c.list("storageclasses", "", opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &storage.StorageClassList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*storage.StorageClass))
+	}
+	return list, nil
+}
+
+type fakeAutoscalingV1 struct {
+	autoscalingv1.AutoscalingV1Interface
+	c *fakeClientset
+}
+
+func (f fakeAutoscalingV1) HorizontalPodAutoscalers(namespace string) autoscalingv1.HorizontalPodAutoscalerInterface {
+	return fakeHorizontalPodAutoscalers{c: f.c, ns: namespace}
+}
+
+type fakeHorizontalPodAutoscalers struct {
+	autoscalingv1.HorizontalPodAutoscalerInterface
+	c  *fakeClientset
+	ns string
+}
+
+func (f fakeHorizontalPodAutoscalers) Get(name string, _ metav1.GetOptions) (*autoscaling.HorizontalPodAutoscaler, error) {
+	obj, err := f.c.get("horizontalpodautoscalers", f.ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*autoscaling.HorizontalPodAutoscaler), nil
+}
+
+func (f fakeHorizontalPodAutoscalers) List(opts metav1.ListOptions) (*autoscaling.HorizontalPodAutoscalerList, error) {
+	objects, err := f.c.list("horizontalpodautoscalers", f.ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &autoscaling.HorizontalPodAutoscalerList{}
+	for _, obj := range objects {
+		list.Items = append(list.Items, *obj.(*autoscaling.HorizontalPodAutoscaler))
+	}
+	return list, nil
+}
+
+func objectMeta(name, namespace string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: namespace}
+}
+
+func TestExtractAllKinds(t *testing.T) {
+	kubeClient := newFakeClientset(
+		&apiv1.Pod{ObjectMeta: objectMeta("pod", "default"), Status: apiv1.PodStatus{Phase: apiv1.PodRunning}},
+		&apiv1.Service{ObjectMeta: objectMeta("svc", "default")},
+		&apiv1.ReplicationController{ObjectMeta: objectMeta("rc", "default"), Status: apiv1.ReplicationControllerStatus{Replicas: 1}},
+		&apiv1.Secret{ObjectMeta: objectMeta("secret", "default")},
+		&apiv1.ConfigMap{ObjectMeta: objectMeta("config", "prod")},
+		&apps.StatefulSet{ObjectMeta: objectMeta("db", "default"), Status: apps.StatefulSetStatus{Replicas: 1}},
+		&apiv1.PersistentVolume{ObjectMeta: objectMeta("pv", "")},
+		&apiv1.PersistentVolumeClaim{ObjectMeta: objectMeta("pvc", "default")},
+		&batch.Job{ObjectMeta: objectMeta("job", "default"), Status: batch.JobStatus{Succeeded: 1}},
+		&extensions.DaemonSet{ObjectMeta: objectMeta("daemon", "default"), Status: extensions.DaemonSetStatus{NumberReady: 1}},
+		&extensions.Deployment{ObjectMeta: objectMeta("web", "default"), Status: extensions.DeploymentStatus{Replicas: 1}},
+		&extensions.ReplicaSet{ObjectMeta: objectMeta("rs", "default"), Status: extensions.ReplicaSetStatus{Replicas: 1}},
+		&storage.StorageClass{ObjectMeta: objectMeta("fast", ""), Provisioner: "kubernetes.io/gce-pd"},
+		&autoscaling.HorizontalPodAutoscaler{ObjectMeta: objectMeta("web", "default"), Status: autoscaling.HorizontalPodAutoscalerStatus{CurrentReplicas: 3}},
+	)
+	ko := KubeObjects{
+		Pods:                     []string{"pod"},
+		Services:                 []string{"svc@default"},
+		ReplicationControllers:   []string{"rc"},
+		Secrets:                  []string{"secret"},
+		ConfigMaps:               []string{"config@prod"},
+		StatefulSets:             []string{"db"},
+		PersistentVolumes:        []string{"pv"},
+		PersistentVolumeClaims:   []string{"pvc"},
+		Jobs:                     []string{"job"},
+		Daemons:                  []string{"daemon"},
+		Deployments:              []string{"web"},
+		ReplicaSets:              []string{"rs"},
+		StorageClasses:           []string{"fast"},
+		HorizontalPodAutoscalers: []string{"web"},
+	}
+	yamlFiles, err := ko.Extract(kubeClient)
+	assert.Nil(t, err)
+
+	expected := []struct {
+		apiVersion, kind, name string
+	}{
+		{"v1", "Pod", "pod"},
+		{"v1", "Service", "svc"},
+		{"v1", "ReplicationController", "rc"},
+		{"v1", "Secret", "secret"},
+		{"v1", "ConfigMap", "config"},
+		{"apps/v1beta1", "StatefulSet", "db"},
+		{"v1", "PersistentVolume", "pv"},
+		{"v1", "PersistentVolumeClaim", "pvc"},
+		{"batch/v1", "Job", "job"},
+		{"extensions/v1beta1", "DaemonSet", "daemon"},
+		{"extensions/v1beta1", "Deployment", "web"},
+		{"extensions/v1beta1", "ReplicaSet", "rs"},
+		{"storage.k8s.io/v1", "StorageClass", "fast"},
+		{"autoscaling/v1", "HorizontalPodAutoscaler", "web"},
+	}
+	assert.Len(t, yamlFiles, len(expected))
+	for i, e := range expected {
+		if i >= len(yamlFiles) {
+			break
+		}
+		var obj struct {
+			metav1.TypeMeta `json:",inline"`
+			ObjectMeta      metav1.ObjectMeta      `json:"metadata"`
+			Status          map[string]interface{} `json:"status"`
+		}
+		assert.Nil(t, yaml.Unmarshal([]byte(yamlFiles[i]), &obj))
+		assert.Equal(t, e.apiVersion, obj.APIVersion)
+		assert.Equal(t, e.kind, obj.Kind)
+		assert.Equal(t, e.name, obj.ObjectMeta.Name)
+		for field, value := range obj.Status {
+			assert.Empty(t, value, "status.%s of %s %s", field, e.kind, e.name)
+		}
+	}
+}
+
+func TestExtractCollectsObjectErrors(t *testing.T) {
+	kubeClient := newFakeClientset(
+		&apiv1.ConfigMap{ObjectMeta: objectMeta("config", "default")},
+		&extensions.Deployment{ObjectMeta: objectMeta("web", "default")},
+	)
+	ko := KubeObjects{
+		ConfigMaps:  []string{"config", "missing@prod", "bad@prod@name"},
+		Deployments: []string{"web"},
+		Secrets:     []string{"gone"},
+	}
+	yamlFiles, err := ko.Extract(kubeClient)
+	assert.Len(t, yamlFiles, 2)
+
+	errs, ok := err.(ExtractErrors)
+	if assert.True(t, ok) && assert.Len(t, errs, 3) {
+		assert.Equal(t, "Secret", errs[0].Kind)
+		assert.Equal(t, "gone", errs[0].Name)
+		assert.True(t, kerr.IsNotFound(errs[0].Err))
+		assert.Equal(t, "ConfigMap", errs[1].Kind)
+		assert.Equal(t, "missing@prod", errs[1].Name)
+		assert.Equal(t, "ConfigMap", errs[2].Kind)
+		assert.Equal(t, "bad@prod@name", errs[2].Name)
+		assert.False(t, kerr.IsNotFound(errs[2].Err))
+	}
+}
+
+func TestExtractKeepsOrderWhenConcurrent(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f"}
+	kubeClient := newFakeClientset()
+	kubeClient.delays = map[string]time.Duration{}
+	for i, name := range names {
+		cm := &apiv1.ConfigMap{ObjectMeta: objectMeta(name, "default")}
+		kubeClient.objects[fakeKey(cm, "default", name)] = cm
+		// later objects are served first
+		kubeClient.delays[name] = time.Duration(len(names)-i) * 10 * time.Millisecond
+	}
+
+	ko := KubeObjects{ConfigMaps: names, Concurrency: 3}
+	yamlFiles, err := ko.Extract(kubeClient)
+	assert.Nil(t, err)
+	var got []string
+	for _, v := range yamlFiles {
+		_, name := getObjectKindAndName(v)
+		got = append(got, name)
+	}
+	assert.Equal(t, names, got)
+	assert.Equal(t, 3, kubeClient.maxInFlight)
+}
+
+// ownedMeta returns the metadata of an object labeled with labels and owned by the object of uid owner.
+func ownedMeta(name, uid, owner string, labels map[string]string) metav1.ObjectMeta {
+	meta := objectMeta(name, "prod")
+	meta.UID = types.UID(uid)
+	meta.Labels = labels
+	if len(owner) != 0 {
+		meta.OwnerReferences = []metav1.OwnerReference{{UID: types.UID(owner)}}
+	}
+	return meta
+}
+
+func TestSelectObjects(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	kubeClient := newFakeClientset(
+		&extensions.Deployment{ObjectMeta: ownedMeta("web", "deploy-uid", "", web)},
+		&extensions.ReplicaSet{ObjectMeta: ownedMeta("web-5d9c", "rs-uid", "deploy-uid", web)},
+		&apiv1.Pod{ObjectMeta: ownedMeta("web-5d9c-a", "pod-a-uid", "rs-uid", web)},
+		&apiv1.Pod{ObjectMeta: ownedMeta("web-5d9c-b", "pod-b-uid", "rs-uid", web)},
+		&apiv1.Service{ObjectMeta: ownedMeta("web", "svc-uid", "", web)},
+		&apiv1.Secret{ObjectMeta: ownedMeta("web-token", "token-uid", "", web), Type: apiv1.SecretTypeServiceAccountToken},
+		&apiv1.Pod{ObjectMeta: ownedMeta("db", "db-uid", "", map[string]string{"app": "db"})},
+		&apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "staging", Labels: web}},
+		&apiv1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "web-data", Labels: web}},
+	)
+
+	ko := KubeObjects{Namespace: "prod", Selector: "app=web"}
+	assert.Nil(t, ko.selectObjects(kubeClient))
+	assert.Equal(t, []string{"web@prod"}, ko.Deployments)
+	assert.Empty(t, ko.ReplicaSets)
+	assert.Empty(t, ko.Pods)
+	assert.Equal(t, []string{"web@prod"}, ko.Services)
+	assert.Empty(t, ko.Secrets)
+	assert.Empty(t, ko.ConfigMaps)
+	assert.Equal(t, []string{"web-data"}, ko.PersistentVolumes)
+
+	// Without a selector, cluster scoped objects aren't selected.
+	ko = KubeObjects{Namespace: "prod", AllInNamespace: true}
+	assert.Nil(t, ko.selectObjects(kubeClient))
+	assert.Equal(t, []string{"web@prod"}, ko.Deployments)
+	assert.Empty(t, ko.ReplicaSets)
+	assert.Equal(t, []string{"db@prod"}, ko.Pods)
+	assert.Empty(t, ko.PersistentVolumes)
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: dev
+  context:
+    cluster: local
+    user: admin
+    namespace: dev
+- name: prod
+  context:
+    cluster: local
+    user: admin
+current-context: dev
+`
+
+func TestNewKubeClientNamespace(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubeconfig")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(testKubeconfig)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	cases := []struct {
+		context, namespace string
+	}{
+		{"", "dev"},
+		// Contexts without a namespace use the default one, as in kubectl.
+		{"prod", "default"},
+	}
+	for _, c := range cases {
+		_, namespace, err := NewKubeClient(ClusterConfig{Kubeconfig: file.Name(), Context: c.context})
+		if assert.Nil(t, err, c.context) {
+			assert.Equal(t, c.namespace, namespace, c.context)
+		}
+	}
+}
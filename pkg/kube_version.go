@@ -0,0 +1,343 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubeVersionRange is the range of Kubernetes 1.x minor versions a chart is generated for. The zero
+// value keeps the apiVersions of the objects as they are.
+type KubeVersionRange struct {
+	Min int
+	Max int
+}
+
+// TargetKubeVersion is the range of Kubernetes versions of the chart being generated.
+var TargetKubeVersion KubeVersionRange
+
+// ParseKubeVersionRange parses a version like 1.25 or v1.25.3, or a range like 1.16-1.25.
+func ParseKubeVersionRange(s string) (KubeVersionRange, error) {
+	var r KubeVersionRange
+	versions := strings.SplitN(s, "-", 2)
+	var err error
+	if r.Min, err = parseKubeMinor(versions[0]); err != nil {
+		return r, err
+	}
+	r.Max = r.Min
+	if len(versions) == 2 {
+		if r.Max, err = parseKubeMinor(versions[1]); err != nil {
+			return r, err
+		}
+	}
+	if r.Max < r.Min {
+		return r, fmt.Errorf("invalid Kubernetes version range %s", s)
+	}
+	return r, nil
+}
+
+func parseKubeMinor(v string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid Kubernetes version %s, expected 1.<minor>", v)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid Kubernetes version %s, expected 1.<minor>", v)
+	}
+	return minor, nil
+}
+
+func (r KubeVersionRange) isSet() bool {
+	return r.Max != 0
+}
+
+// apiVersionRange is the range of minor versions an apiVersion is served in. Removed is the first
+// minor version that doesn't serve it anymore, or 0.
+type apiVersionRange struct {
+	apiVersion string
+	introduced int
+	removed    int
+}
+
+func (v apiVersionRange) servedIn(minor int) bool {
+	return minor >= v.introduced && (v.removed == 0 || minor < v.removed)
+}
+
+// kindVersions lists, oldest first, the apiVersions of a kind that objects can be converted between
+// by changing their apiVersion.
+var kindVersions = map[string][]apiVersionRange{
+	"Deployment":              {{"extensions/v1beta1", 0, 16}, {"apps/v1beta1", 6, 16}, {"apps/v1beta2", 8, 16}, {"apps/v1", 9, 0}},
+	"DaemonSet":               {{"extensions/v1beta1", 0, 16}, {"apps/v1beta2", 8, 16}, {"apps/v1", 9, 0}},
+	"ReplicaSet":              {{"extensions/v1beta1", 0, 16}, {"apps/v1beta2", 8, 16}, {"apps/v1", 9, 0}},
+	"StatefulSet":             {{"apps/v1beta1", 5, 16}, {"apps/v1beta2", 8, 16}, {"apps/v1", 9, 0}},
+	"CronJob":                 {{"batch/v1beta1", 8, 25}, {"batch/v1", 21, 0}},
+	"Ingress":                 {{"extensions/v1beta1", 0, 22}, {"networking.k8s.io/v1beta1", 14, 22}, {networkingV1, 19, 0}},
+	"NetworkPolicy":           {{"extensions/v1beta1", 3, 16}, {"networking.k8s.io/v1", 7, 0}},
+	"PodSecurityPolicy":       {{"extensions/v1beta1", 3, 16}, {"policy/v1beta1", 10, 25}},
+	"PodDisruptionBudget":     {{"policy/v1beta1", 5, 25}, {"policy/v1", 21, 0}},
+	"HorizontalPodAutoscaler": {{"autoscaling/v2beta1", 8, 25}, {"autoscaling/v2beta2", 12, 26}, {"autoscaling/v2", 23, 0}},
+	"PriorityClass":           {{"scheduling.k8s.io/v1beta1", 11, 22}, {"scheduling.k8s.io/v1", 14, 0}},
+	"Role":                    {{"rbac.authorization.k8s.io/v1beta1", 6, 22}, {"rbac.authorization.k8s.io/v1", 8, 0}},
+	"RoleBinding":             {{"rbac.authorization.k8s.io/v1beta1", 6, 22}, {"rbac.authorization.k8s.io/v1", 8, 0}},
+	"ClusterRole":             {{"rbac.authorization.k8s.io/v1beta1", 6, 22}, {"rbac.authorization.k8s.io/v1", 8, 0}},
+	"ClusterRoleBinding":      {{"rbac.authorization.k8s.io/v1beta1", 6, 22}, {"rbac.authorization.k8s.io/v1", 8, 0}},
+}
+
+// versionSegment is a range of minor versions, from and to included, in which apiVersion is the newest
+// served version of a kind. apiVersion is empty if none is served.
+type versionSegment struct {
+	from       int
+	to         int
+	apiVersion string
+}
+
+// segments returns the apiVersions objects of typeMeta should have over r, or false if they can't be
+// converted.
+func (r KubeVersionRange) segments(typeMeta metav1.TypeMeta) ([]versionSegment, bool) {
+	versions, ok := kindVersions[typeMeta.Kind]
+	if !ok || !r.isSet() {
+		return nil, false
+	}
+	known := false
+	for _, v := range versions {
+		known = known || v.apiVersion == typeMeta.APIVersion
+	}
+	if !known {
+		return nil, false
+	}
+	var segs []versionSegment
+	for minor := r.Min; minor <= r.Max; minor++ {
+		apiVersion := ""
+		for _, v := range versions {
+			if v.servedIn(minor) {
+				apiVersion = v.apiVersion
+			}
+		}
+		if n := len(segs); n != 0 && segs[n-1].apiVersion == apiVersion {
+			segs[n-1].to = minor
+			continue
+		}
+		segs = append(segs, versionSegment{minor, minor, apiVersion})
+	}
+	return segs, true
+}
+
+// kubeVersionCondition returns a template condition that is true on Kubernetes versions matching constraint.
+func kubeVersionCondition(constraint string) string {
+	return fmt.Sprintf("semverCompare %q $.Capabilities.KubeVersion.GitVersion", constraint)
+}
+
+// served returns the segments of r in which objects of typeMeta have an apiVersion, or false if
+// they aren't converted.
+func (r KubeVersionRange) served(typeMeta metav1.TypeMeta) ([]versionSegment, bool) {
+	segs, ok := r.segments(typeMeta)
+	if !ok {
+		return nil, false
+	}
+	var served []versionSegment
+	for _, s := range segs {
+		if len(s.apiVersion) != 0 {
+			served = append(served, s)
+		}
+	}
+	return served, true
+}
+
+// serves reports whether some version of r serves objects of typeMeta.
+func (r KubeVersionRange) serves(typeMeta metav1.TypeMeta) bool {
+	served, ok := r.served(typeMeta)
+	return !ok || len(served) != 0
+}
+
+// sinceCondition returns the condition under which objects of typeMeta get apiVersion, empty if they
+// always get it, and whether they get it at all.
+func (r KubeVersionRange) sinceCondition(typeMeta metav1.TypeMeta, apiVersion string) (string, bool) {
+	served, ok := r.served(typeMeta)
+	if !ok {
+		return "", typeMeta.APIVersion == apiVersion
+	}
+	for i, s := range served {
+		if s.apiVersion != apiVersion {
+			continue
+		}
+		if i == 0 {
+			return "", true
+		}
+		return kubeVersionCondition(fmt.Sprintf(">=1.%d-0", s.from)), true
+	}
+	return "", false
+}
+
+// applyKubeVersion sets the apiVersion of template to the ones serving its kind in TargetKubeVersion,
+// switching on .Capabilities.KubeVersion if they differ over the range. Templates of kinds removed
+// within the range are only rendered on versions serving them.
+func applyKubeVersion(template string, typeMeta metav1.TypeMeta) string {
+	served, ok := TargetKubeVersion.served(typeMeta)
+	if !ok || len(served) == 0 {
+		return template
+	}
+
+	var apiVersion bytes.Buffer
+	if len(served) == 1 {
+		fmt.Fprintf(&apiVersion, "apiVersion: %s\n", served[0].apiVersion)
+	} else {
+		for i := len(served) - 1; i >= 0; i-- {
+			switch {
+			case i == len(served)-1:
+				fmt.Fprintf(&apiVersion, "{{- if %s }}\n", kubeVersionCondition(fmt.Sprintf(">=1.%d-0", served[i].from)))
+			case i == 0:
+				apiVersion.WriteString("{{- else }}\n")
+			default:
+				fmt.Fprintf(&apiVersion, "{{- else if %s }}\n", kubeVersionCondition(fmt.Sprintf(">=1.%d-0", served[i].from)))
+			}
+			fmt.Fprintf(&apiVersion, "apiVersion: %s\n", served[i].apiVersion)
+		}
+		apiVersion.WriteString("{{- end }}\n")
+	}
+
+	var buf bytes.Buffer
+	for _, l := range strings.Split(template, "\n") {
+		if len(l) == 0 {
+			continue
+		}
+		if strings.HasPrefix(l, "apiVersion: ") {
+			buf.Write(apiVersion.Bytes())
+		} else {
+			buf.WriteString(l + "\n")
+		}
+	}
+
+	// Some versions of the range don't serve the kind at all.
+	first, last := served[0], served[len(served)-1]
+	var constraints []string
+	if first.from != TargetKubeVersion.Min {
+		constraints = append(constraints, fmt.Sprintf(">=1.%d-0", first.from))
+	}
+	if last.to != TargetKubeVersion.Max {
+		constraints = append(constraints, fmt.Sprintf("<1.%d-0", last.to+1))
+	}
+	if len(constraints) == 0 {
+		return buf.String()
+	}
+	return fmt.Sprintf("{{- if %s }}\n%s{{- end }}\n", kubeVersionCondition(strings.Join(constraints, ", ")), buf.String())
+}
+
+// selectorRequired lists the kinds whose apps/v1 version requires spec.selector.
+var selectorRequired = map[string]bool{
+	"Deployment":  true,
+	"DaemonSet":   true,
+	"ReplicaSet":  true,
+	"StatefulSet": true,
+}
+
+// defaultSelector sets spec.selector of workloads without one to the labels of their pod template,
+// as apps/v1 requires a selector and older versions defaulted to these labels.
+func defaultSelector(kubeJson []byte) []byte {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(kubeJson, &obj); err != nil {
+		log.Fatal(err)
+	}
+	if kind, _ := obj["kind"].(string); !selectorRequired[kind] {
+		return kubeJson
+	}
+	spec, _ := obj["spec"].(map[string]interface{})
+	if spec == nil || spec["selector"] != nil {
+		return kubeJson
+	}
+	template, _ := spec["template"].(map[string]interface{})
+	metadata, _ := template["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if len(labels) == 0 {
+		return kubeJson
+	}
+	matchLabels := make(map[string]interface{})
+	for k, v := range labels {
+		matchLabels[k] = v
+	}
+	spec["selector"] = map[string]interface{}{"matchLabels": matchLabels}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
+
+// applyKubeVersionToReferences sets the apiVersion of the objects template refers to by apiVersion and
+// kind, like the scaleTargetRef of HorizontalPodAutoscalers, to the ones their kind gets in
+// TargetKubeVersion, as applyKubeVersion does for the objects themselves.
+func applyKubeVersionToReferences(template string) string {
+	if !TargetKubeVersion.isSet() {
+		return template
+	}
+	lines := strings.Split(template, "\n")
+	for i, l := range lines {
+		field, indent, _ := yamlField(l)
+		if indent == 0 || !strings.HasPrefix(field, "apiVersion: ") {
+			continue
+		}
+		apiVersion := strings.TrimPrefix(field, "apiVersion: ")
+		typeMeta := metav1.TypeMeta{APIVersion: strings.Trim(apiVersion, `'"`), Kind: siblingKind(lines, i, indent)}
+		served, ok := TargetKubeVersion.served(typeMeta)
+		if !ok || len(served) == 0 {
+			continue
+		}
+		var value bytes.Buffer
+		if len(served) == 1 {
+			value.WriteString(served[0].apiVersion)
+		} else {
+			for i := len(served) - 1; i >= 0; i-- {
+				switch {
+				case i == len(served)-1:
+					fmt.Fprintf(&value, "{{ if %s }}", kubeVersionCondition(fmt.Sprintf(">=1.%d-0", served[i].from)))
+				case i == 0:
+					value.WriteString("{{ else }}")
+				default:
+					fmt.Fprintf(&value, "{{ else if %s }}", kubeVersionCondition(fmt.Sprintf(">=1.%d-0", served[i].from)))
+				}
+				value.WriteString(served[i].apiVersion)
+			}
+			value.WriteString("{{ end }}")
+		}
+		lines[i] = strings.TrimSuffix(l, apiVersion) + value.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// siblingKind returns the kind set next to the field on line i, of the given indentation, or "".
+func siblingKind(lines []string, i int, indent int) string {
+	// The mapping of the field starts at the list item holding it, if any.
+	for j := i; j >= 0; j-- {
+		field, fieldIndent, item := yamlField(lines[j])
+		if len(field) == 0 && !item {
+			continue
+		}
+		if fieldIndent < indent {
+			break
+		}
+		if fieldIndent == indent && strings.HasPrefix(field, "kind: ") {
+			return strings.Trim(strings.TrimPrefix(field, "kind: "), `'"`)
+		}
+		if fieldIndent == indent && item {
+			break
+		}
+	}
+	for j := i + 1; j < len(lines); j++ {
+		field, fieldIndent, item := yamlField(lines[j])
+		if len(field) == 0 {
+			continue
+		}
+		if fieldIndent < indent || fieldIndent == indent && item {
+			break
+		}
+		if fieldIndent == indent && strings.HasPrefix(field, "kind: ") {
+			return strings.Trim(strings.TrimPrefix(field, "kind: "), `'"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	ylib "github.com/ghodss/yaml"
+)
+
+// passthroughTemplate templates the name, namespace and labels of an object of a kind chartify doesn't
+// know and keeps the rest as is. It can be turned off with <name>.<kind>.enabled.
+func passthroughTemplate(objJson []byte) (string, valueFileGenerator) {
+	template, values, header := unstructuredTemplate(objJson)
+	key := generateSafeKey(header.Name)
+	kindKey := strings.ToLower(header.Kind[:1]) + header.Kind[1:]
+	values.value[kindKey] = map[string]interface{}{
+		Enabled: true,
+	}
+	template = fmt.Sprintf("{{- if .Values.%s.%s.%s -}}\n%s{{- end -}}\n", key, kindKey, Enabled, template)
+	return template, values
+}
+
+// unstructuredTemplate templates the metadata of an object and keeps the rest of it as is, since
+// empty fields may have a meaning for kinds chartify doesn't know. Template text in it, like the
+// {{ $labels.instance }} of a PrometheusRule, is escaped to be rendered as it is.
+func unstructuredTemplate(objJson []byte) (string, valueFileGenerator, objectHeader) {
+	obj := objectHeader{}
+	if err := json.Unmarshal(objJson, &obj); err != nil {
+		log.Fatal(err)
+	}
+	header := obj
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(objJson, &fields); err != nil {
+		log.Fatal(err)
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	delete(fields, "metadata")
+	delete(fields, "status")
+	fields = escapeTemplateText(fields).(map[string]interface{})
+
+	cleanUpObjectMeta(&obj.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(obj.ObjectMeta.Name)
+	obj.ObjectMeta = generateObjectMetaTemplate(obj.ObjectMeta, key, value, obj.ObjectMeta.Name)
+	metadata, err := ylib.Marshal(obj)
+	if err != nil {
+		log.Fatal(err)
+	}
+	template := removeEmptyFields(string(metadata))
+	if len(fields) != 0 {
+		fieldsData, err := ylib.Marshal(fields)
+		if err != nil {
+			log.Fatal(err)
+		}
+		template += string(fieldsData)
+	}
+	return template, valueFileGenerator{value: value}, header
+}
+
+// templateTextEscaper escapes the delimiters of Go templates as backquoted strings, which are kept as they
+// are by every yaml quoting style.
+var templateTextEscaper = strings.NewReplacer("{{", "{{`{{`}}", "}}", "{{`}}`}}")
+
+// escapeTemplateText returns obj, decoded from json, with the template text of its keys and strings
+// escaped.
+func escapeTemplateText(obj interface{}) interface{} {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			escaped[templateTextEscaper.Replace(k)] = escapeTemplateText(v)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(o))
+		for i, v := range o {
+			escaped[i] = escapeTemplateText(v)
+		}
+		return escaped
+	case string:
+		return templateTextEscaper.Replace(o)
+	}
+	return obj
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// networkPolicy holds the fields of a networking.k8s.io/v1 NetworkPolicy.
+type networkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              networkPolicySpec `json:"spec"`
+}
+
+type networkPolicySpec struct {
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+	Ingress     []networkPolicyRule  `json:"ingress,omitempty"`
+	Egress      []networkPolicyRule  `json:"egress,omitempty"`
+	PolicyTypes []string             `json:"policyTypes,omitempty"`
+}
+
+type networkPolicyRule struct {
+	Ports []map[string]interface{} `json:"ports,omitempty"`
+	From  []networkPolicyPeer      `json:"from,omitempty"`
+	To    []networkPolicyPeer      `json:"to,omitempty"`
+}
+
+type networkPolicyPeer struct {
+	PodSelector       *metav1.LabelSelector  `json:"podSelector,omitempty"`
+	NamespaceSelector *metav1.LabelSelector  `json:"namespaceSelector,omitempty"`
+	IPBlock           map[string]interface{} `json:"ipBlock,omitempty"`
+}
+
+// podDisruptionBudget holds the fields of a policy/v1beta1 or policy/v1 PodDisruptionBudget.
+type podDisruptionBudget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		MinAvailable               *intstr.IntOrString   `json:"minAvailable,omitempty"`
+		MaxUnavailable             *intstr.IntOrString   `json:"maxUnavailable,omitempty"`
+		Selector                   *metav1.LabelSelector `json:"selector,omitempty"`
+		UnhealthyPodEvictionPolicy string                `json:"unhealthyPodEvictionPolicy,omitempty"`
+	} `json:"spec"`
+}
+
+func networkPolicyTemplate(np networkPolicy) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&np.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(np.ObjectMeta.Name)
+	np.ObjectMeta = generateObjectMetaTemplate(np.ObjectMeta, key, value, np.ObjectMeta.Name)
+	value[NetworkPolicy] = map[string]interface{}{
+		Enabled: true,
+	}
+
+	modifyPodSelector(&np.Spec.PodSelector)
+	for _, rules := range [][]networkPolicyRule{np.Spec.Ingress, np.Spec.Egress} {
+		for _, rule := range rules {
+			for _, peer := range append(rule.From, rule.To...) {
+				modifyPodSelector(peer.PodSelector)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{{- if .Values.%s.%s.%s -}}\n", key, NetworkPolicy, Enabled)
+	buf.WriteString(policyTemplate(np.TypeMeta, np.ObjectMeta, np.Spec))
+	buf.WriteString("{{- end -}}\n")
+	return buf.String(), valueFileGenerator{value: value}
+}
+
+func podDisruptionBudgetTemplate(pdb podDisruptionBudget) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&pdb.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(pdb.ObjectMeta.Name)
+	pdb.ObjectMeta = generateObjectMetaTemplate(pdb.ObjectMeta, key, value, pdb.ObjectMeta.Name)
+	pdbValue := map[string]interface{}{
+		Enabled: true,
+	}
+	modifyPodSelector(pdb.Spec.Selector)
+
+	template := policyTemplate(pdb.TypeMeta, pdb.ObjectMeta, pdb.Spec)
+	values := key + "." + PodDisruptionBudget
+	for field, v := range map[string]*intstr.IntOrString{
+		MinAvailable:   pdb.Spec.MinAvailable,
+		MaxUnavailable: pdb.Spec.MaxUnavailable,
+	} {
+		if v == nil {
+			continue
+		}
+		if v.Type == intstr.String {
+			pdbValue[field] = v.StrVal
+		} else {
+			pdbValue[field] = v.IntVal
+		}
+		template = updateIntParamAsStringInTemplate(template, values, field)
+	}
+	value[PodDisruptionBudget] = pdbValue
+
+	template = fmt.Sprintf("{{- if .Values.%s.%s -}}\n%s{{- end -}}\n", values, Enabled, template)
+	return template, valueFileGenerator{value: value}
+}
+
+// policyTemplate marshals spec as is, since an empty selector or rule selects everything and must
+// not be removed as an empty field.
+func policyTemplate(typeMeta metav1.TypeMeta, objectMeta metav1.ObjectMeta, spec interface{}) string {
+	header, err := ylib.Marshal(struct {
+		metav1.TypeMeta `json:",inline"`
+		Metadata        metav1.ObjectMeta `json:"metadata"`
+	}{typeMeta, objectMeta})
+	if err != nil {
+		log.Fatal(err)
+	}
+	specData, err := ylib.Marshal(map[string]interface{}{"spec": spec})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(header)) + string(specData)
+}
@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/appscode/go/encoding/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// TargetPorts holds, by Service port as <service>/<port key>, the values of the container ports of the
+// chart that the Services target, so that both are rendered from the same value.
+var TargetPorts map[string]string
+
+// containerPortKey returns the key of the value of port among the ports of its container.
+func containerPortKey(port apiv1.ContainerPort) string {
+	return namedPortKey(port.Name, port.ContainerPort, port.Protocol)
+}
+
+// servicePortKey returns the key of the values of port among the ports of its Service.
+func servicePortKey(port apiv1.ServicePort) string {
+	return namedPortKey(port.Name, port.Port, port.Protocol)
+}
+
+func namedPortKey(name string, number int32, protocol apiv1.Protocol) string {
+	if key := generateSafeKey(name); len(key) != 0 {
+		return key
+	}
+	key := fmt.Sprintf("port%d", number)
+	if len(protocol) != 0 && protocol != apiv1.ProtocolTCP {
+		key += strings.ToLower(string(protocol))
+	}
+	return key
+}
+
+// containerPortValues returns the values of the container ports, by port key.
+func containerPortValues(ports []apiv1.ContainerPort) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, p := range ports {
+		values[containerPortKey(p)] = p.ContainerPort
+	}
+	return values
+}
+
+// templateContainerPorts renders the containerPort of each of the ports of the container called name
+// of list from the values at values, by port key.
+func templateContainerPorts(template string, list string, name string, values string, ports []apiv1.ContainerPort) string {
+	lines := strings.Split(strings.TrimSuffix(template, "\n"), "\n")
+	start, end, _ := findContainer(lines, list, name)
+	if start == -1 {
+		return template
+	}
+	i := 0
+	for l := start; l < end && i < len(ports); l++ {
+		field, _, _ := yamlField(lines[l])
+		if !strings.HasPrefix(field, "containerPort: ") {
+			continue
+		}
+		lines[l] = strings.TrimSuffix(lines[l], strings.TrimPrefix(field, "containerPort: "))
+		lines[l] += fmt.Sprintf("{{ %s.%s }}", values, containerPortKey(ports[i]))
+		i++
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// generateServicePortValues sets the values of the ports of a Service. The nodePort is only set if it
+// was, a target port of a container of the chart is left to the value of the container port.
+func generateServicePortValues(name string, ports []apiv1.ServicePort, value map[string]interface{}) {
+	portValues := make(map[string]interface{})
+	for _, p := range ports {
+		key := servicePortKey(p)
+		v := map[string]interface{}{Port: p.Port}
+		if p.NodePort != 0 {
+			v[NodePort] = p.NodePort
+		}
+		if _, ok := TargetPorts[name+"/"+key]; !ok {
+			if p.TargetPort.Type == intstr.String {
+				v[TargetPort] = p.TargetPort.StrVal
+			} else if p.TargetPort.IntVal != 0 {
+				v[TargetPort] = p.TargetPort.IntVal
+			}
+		}
+		portValues[key] = v
+	}
+	value[Ports] = portValues
+}
+
+// serviceValues returns the fields of a Service spec newer than apiv1.ServiceSpec that
+// serviceSpecTemplate renders from values.
+func serviceValues(fields map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	if policy, ok := fields[ExternalTrafficPolicy].(string); ok {
+		values[ExternalTrafficPolicy] = policy
+	}
+	return values
+}
+
+// serviceSpecTemplate renders the fields of the spec of the Service called name, whose values are at
+// key, that generateServiceSpecTemplate moves to values.
+func serviceSpecTemplate(key string, name string, ports []apiv1.ServicePort) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{{- with .Values.%s.%s }}\n", key, ExternalTrafficPolicy)
+	fmt.Fprintf(&buf, "%s: {{ . }}\n", ExternalTrafficPolicy)
+	buf.WriteString("{{- end }}\n")
+	fmt.Fprintf(&buf, "{{- with .Values.%s.%s }}\n", key, LoadBalancerSourceRanges)
+	fmt.Fprintf(&buf, "%s: {{- toYaml . | nindent 4 }}\n", LoadBalancerSourceRanges)
+	buf.WriteString("{{- end }}\n")
+	if len(ports) != 0 {
+		buf.WriteString(servicePortsTemplate(key, name, ports))
+	}
+	return buf.String()
+}
+
+// servicePortsTemplate renders the ports of the Service called name, whose values are at key, from
+// values.
+func servicePortsTemplate(key string, name string, ports []apiv1.ServicePort) string {
+	var buf bytes.Buffer
+	buf.WriteString("ports:\n")
+	for _, p := range ports {
+		portKey := servicePortKey(p)
+		values := fmt.Sprintf(".Values.%s.%s.%s", key, Ports, portKey)
+		var fields []string
+		if len(p.Name) != 0 {
+			fields = append(fields, "name: "+p.Name)
+		}
+		fields = append(fields, fmt.Sprintf("%s: {{ %s.%s }}", Port, values, Port))
+		if len(p.Protocol) != 0 {
+			fields = append(fields, "protocol: "+string(p.Protocol))
+		}
+		if target, ok := TargetPorts[name+"/"+portKey]; ok {
+			fields = append(fields, fmt.Sprintf("%s: {{ %s }}", TargetPort, target))
+		} else if p.TargetPort.Type == intstr.String || p.TargetPort.IntVal != 0 {
+			fields = append(fields, fmt.Sprintf("%s: {{ %s.%s }}", TargetPort, values, TargetPort))
+		}
+		for i, f := range fields {
+			if i == 0 {
+				buf.WriteString("- " + f + "\n")
+			} else {
+				buf.WriteString("  " + f + "\n")
+			}
+		}
+		fmt.Fprintf(&buf, "  {{- with %s.%s }}\n", values, NodePort)
+		fmt.Fprintf(&buf, "  %s: {{ . }}\n", NodePort)
+		buf.WriteString("  {{- end }}\n")
+	}
+	return buf.String()
+}
+
+// getTargetPorts returns the values of the container ports of the workloads among objects that the
+// Services among objects target by number, by Service port as <service>/<port key>. Ports targeted by
+// name follow the container port already.
+func getTargetPorts(objects []string, rules SanitizeRules) map[string]string {
+	type workloadPods struct {
+		key        string
+		labels     map[string]string
+		containers []apiv1.Container
+	}
+	var workloads []workloadPods
+	var services []apiv1.Service
+	for _, v := range objects {
+		kubeJson, err := yaml.ToJSON([]byte(v))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if kubeJson, err = rules.SanitizeJSON(kubeJson); err != nil {
+			log.Fatal(err)
+		}
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(kubeJson, &typeMeta); err != nil {
+			log.Fatal(err)
+		}
+		if !TargetKubeVersion.serves(typeMeta) {
+			continue
+		}
+		switch handledKind(typeMeta) {
+		case "Pod":
+			pod := apiv1.Pod{}
+			if err := json.Unmarshal(kubeJson, &pod); err != nil {
+				log.Fatal(err)
+			}
+			workloads = append(workloads, workloadPods{generateSafeKey(pod.Name), pod.Labels, pod.Spec.Containers})
+		case "ReplicationController", "Deployment", "ReplicaSet", "DaemonSet", "StatefulSet", "Job":
+			var workload struct {
+				metav1.ObjectMeta `json:"metadata,omitempty"`
+				Spec              struct {
+					Template apiv1.PodTemplateSpec `json:"template,omitempty"`
+				} `json:"spec,omitempty"`
+			}
+			if err := json.Unmarshal(kubeJson, &workload); err != nil {
+				log.Fatal(err)
+			}
+			workloads = append(workloads, workloadPods{generateSafeKey(workload.Name), workload.Spec.Template.Labels, workload.Spec.Template.Spec.Containers})
+		case "Service":
+			svc := apiv1.Service{}
+			if err := json.Unmarshal(kubeJson, &svc); err != nil {
+				log.Fatal(err)
+			}
+			services = append(services, svc)
+		}
+	}
+
+	targets := make(map[string]string)
+	for _, svc := range services {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		for _, p := range svc.Spec.Ports {
+			if p.TargetPort.Type == intstr.String {
+				continue
+			}
+			number := p.TargetPort.IntVal
+			if number == 0 {
+				number = p.Port
+			}
+		search:
+			for _, w := range workloads {
+				if !selects(svc.Spec.Selector, w.labels) {
+					continue
+				}
+				for _, c := range w.containers {
+					for _, cp := range c.Ports {
+						if cp.ContainerPort == number && sameProtocol(cp.Protocol, p.Protocol) {
+							targets[svc.Name+"/"+servicePortKey(p)] = fmt.Sprintf(".Values.%s.%s.%s.%s", w.key, generateSafeKey(c.Name), Ports, containerPortKey(cp))
+							break search
+						}
+					}
+				}
+			}
+		}
+	}
+	return targets
+}
+
+func selects(selector map[string]string, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sameProtocol compares protocols, TCP if empty.
+func sameProtocol(a, b apiv1.Protocol) bool {
+	if len(a) == 0 {
+		a = apiv1.ProtocolTCP
+	}
+	if len(b) == 0 {
+		b = apiv1.ProtocolTCP
+	}
+	return a == b
+}
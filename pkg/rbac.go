@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	ylib "github.com/ghodss/yaml"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+// clusterRole adds the aggregationRule of rbac.authorization.k8s.io/v1 to rbac.ClusterRole.
+type clusterRole struct {
+	rbac.ClusterRole `json:",inline"`
+	AggregationRule  map[string]interface{} `json:"aggregationRule,omitempty"`
+}
+
+// serviceAccountNameTemplate returns the name of a service account of the chart, as set by its
+// serviceAccount.create and serviceAccount.name values.
+func serviceAccountNameTemplate(name string) string {
+	key := generateSafeKey(name)
+	if PreserveName {
+		return fmt.Sprintf(`{{ default "%s" $.Values.%s.%s.name }}`, name, key, ServiceAccount)
+	}
+	return fmt.Sprintf(`{{ include "serviceAccountName" (dict "root" $ "key" "%s" "name" "%s") }}`, key, name)
+}
+
+// clusterScopedName returns the name of a cluster scoped object of the chart. It always includes the
+// release, so that two releases of the chart don't collide.
+func clusterScopedName(name string) string {
+	if PreserveName {
+		return fmt.Sprintf("{{ .Release.Name }}-%s", name)
+	}
+	return fmt.Sprintf(`{{ template "fullname" . }}-%s`, name)
+}
+
+// rulesTemplate renders the rules of a role on their own, as removeEmptyFields would drop the "" of the
+// core API group.
+func rulesTemplate(rules []rbac.PolicyRule) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var ruleList []map[string]interface{}
+	if err := json.Unmarshal(data, &ruleList); err != nil {
+		log.Fatal(err)
+	}
+	for _, rule := range ruleList {
+		for k, v := range rule {
+			if v == nil {
+				delete(rule, k)
+			}
+		}
+	}
+	rulesData, err := ylib.Marshal(map[string]interface{}{"rules": ruleList})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(rulesData)
+}
+
+func roleRefTemplate(ref rbac.RoleRef) rbac.RoleRef {
+	switch {
+	case ref.Kind == "Role" && checkIfNameExist(ref.Name, "Role") && !PreserveName:
+		ref.Name = fmt.Sprintf(`{{ template "fullname" . }}-%s`, ref.Name)
+	case ref.Kind == "ClusterRole" && checkIfNameExist(ref.Name, "ClusterRole"):
+		ref.Name = clusterScopedName(ref.Name)
+	}
+	return ref
+}
+
+func subjectsTemplate(subjects []rbac.Subject) []rbac.Subject {
+	for i, s := range subjects {
+		if s.Kind != "ServiceAccount" || !checkIfNameExist(s.Name, "ServiceAccount") {
+			continue
+		}
+		// The service account is installed in its templated namespace, or the release namespace if it has none.
+		subjects[i].Namespace = fmt.Sprintf("{{ default .Release.Namespace .Values.%s.%s }}", generateSafeKey(s.Name), Namespace)
+		subjects[i].Name = serviceAccountNameTemplate(s.Name)
+	}
+	return subjects
+}
+
+func serviceAccountTemplate(sa apiv1.ServiceAccount) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&sa.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(sa.ObjectMeta.Name)
+	name := sa.ObjectMeta.Name
+	sa.ObjectMeta = generateObjectMetaTemplate(sa.ObjectMeta, key, value, name)
+	sa.ObjectMeta.Name = serviceAccountNameTemplate(name)
+	// Token secrets are generated by the cluster.
+	sa.Secrets = nil
+	for i, s := range sa.ImagePullSecrets {
+		if checkIfNameExist(s.Name, "Secret") {
+			sa.ImagePullSecrets[i].Name = fmt.Sprintf(`{{ template "fullname" . }}-%s`, s.Name)
+		}
+	}
+	value[ServiceAccount] = map[string]interface{}{
+		Create: true,
+		"name": "",
+	}
+	saData, err := ylib.Marshal(sa)
+	if err != nil {
+		log.Fatal(err)
+	}
+	temp := removeEmptyFields(string(saData))
+	template := fmt.Sprintf("{{- if .Values.%s.%s.%s -}}\n%s{{- end -}}", key, ServiceAccount, Create, temp)
+	return template, valueFileGenerator{value: value}
+}
+
+func roleTemplate(role rbac.Role) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&role.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(role.ObjectMeta.Name)
+	role.ObjectMeta = generateObjectMetaTemplate(role.ObjectMeta, key, value, role.ObjectMeta.Name)
+	rules := role.Rules
+	role.Rules = nil
+	roleData, err := ylib.Marshal(role)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(roleData)) + rulesTemplate(rules), valueFileGenerator{value: value}
+}
+
+func clusterRoleTemplate(role clusterRole) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&role.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(role.ObjectMeta.Name)
+	name := role.ObjectMeta.Name
+	role.ObjectMeta = generateObjectMetaTemplate(role.ObjectMeta, key, value, name)
+	role.ObjectMeta.Name = clusterScopedName(name)
+	rules := role.Rules
+	role.Rules = nil
+	roleData, err := ylib.Marshal(role)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(roleData)) + rulesTemplate(rules), valueFileGenerator{value: value}
+}
+
+func roleBindingTemplate(binding rbac.RoleBinding) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&binding.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(binding.ObjectMeta.Name)
+	binding.ObjectMeta = generateObjectMetaTemplate(binding.ObjectMeta, key, value, binding.ObjectMeta.Name)
+	binding.Subjects = subjectsTemplate(binding.Subjects)
+	binding.RoleRef = roleRefTemplate(binding.RoleRef)
+	bindingData, err := ylib.Marshal(binding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(bindingData)), valueFileGenerator{value: value}
+}
+
+func clusterRoleBindingTemplate(binding rbac.ClusterRoleBinding) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&binding.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(binding.ObjectMeta.Name)
+	name := binding.ObjectMeta.Name
+	binding.ObjectMeta = generateObjectMetaTemplate(binding.ObjectMeta, key, value, name)
+	binding.ObjectMeta.Name = clusterScopedName(name)
+	binding.Subjects = subjectsTemplate(binding.Subjects)
+	binding.RoleRef = roleRefTemplate(binding.RoleRef)
+	bindingData, err := ylib.Marshal(binding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(bindingData)), valueFileGenerator{value: value}
+}
@@ -0,0 +1,326 @@
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/appscode/go/encoding/yaml"
+	ylib "github.com/ghodss/yaml"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Source records where a Kubernetes object was read from.
+type Source struct {
+	File string
+	// Index is the position of the YAML document inside File.
+	Index int
+	// Item is the position inside a List document, or -1 if the object was not part of a list.
+	Item int
+}
+
+func (s Source) String() string {
+	if s.Item < 0 {
+		return fmt.Sprintf("%s (document %d)", s.File, s.Index)
+	}
+	return fmt.Sprintf("%s (document %d, item %d)", s.File, s.Index, s.Item)
+}
+
+// ReadLocalFiles walks dirName recursively and reads every Kubernetes object from the files accepted by filter
+// and not excluded by a .chartifyignore file.
+func ReadLocalFiles(dirName string, filter FileFilter) ([]string, []Source, error) {
+	var yamlFiles []string
+	var sources []Source
+	var rules ignoreRules
+	err := filepath.Walk(dirName, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath := relativeSlashPath(dirName, fileName)
+		if info.IsDir() {
+			excluded, err := matchAny(filter.Exclude, relPath)
+			if err != nil {
+				return err
+			}
+			if fileName != dirName && (rules.ignored(relPath, true) || excluded) {
+				return filepath.SkipDir
+			}
+			base := relPath
+			if fileName == dirName {
+				base = ""
+			}
+			dirRules, err := readIgnoreFile(filepath.Join(fileName, IgnoreFileName), base)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, dirRules...)
+			return nil
+		}
+		if rules.ignored(relPath, false) {
+			return nil
+		}
+		if accepted, err := filter.accepts(relPath); err != nil || !accepted {
+			return err
+		}
+		dataByte, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		objects, objSources, err := SplitObjects(fileName, dataByte)
+		if err != nil {
+			return err
+		}
+		yamlFiles = append(yamlFiles, objects...)
+		sources = append(sources, objSources...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return yamlFiles, sources, nil
+}
+
+// Stdin is read when "-" is given as file name to ReadFile.
+var Stdin io.Reader = os.Stdin
+
+// ReadFile reads Kubernetes objects from a single file, a directory, a .tar, .tar.gz or .zip
+// archive of manifests, or from stdin if fileName is "-". Archive members are selected with filter.
+func ReadFile(fileName string, filter FileFilter) ([]string, []Source, error) {
+	var yamlFiles []string
+	var sources []Source
+	add := func(name string, data []byte) error {
+		objects, objSources, err := SplitObjects(name, data)
+		if err != nil {
+			return err
+		}
+		yamlFiles = append(yamlFiles, objects...)
+		sources = append(sources, objSources...)
+		return nil
+	}
+
+	var err error
+	lower := strings.ToLower(fileName)
+	switch {
+	case fileName == "-":
+		var data []byte
+		if data, err = ioutil.ReadAll(Stdin); err == nil {
+			err = add("<stdin>", data)
+		}
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		err = readTarArchive(fileName, true, filter, add)
+	case strings.HasSuffix(lower, ".tar"):
+		err = readTarArchive(fileName, false, filter, add)
+	case strings.HasSuffix(lower, ".zip"):
+		err = readZipArchive(fileName, filter, add)
+	default:
+		var fi os.FileInfo
+		if fi, err = os.Stat(fileName); err == nil && fi.IsDir() {
+			return ReadLocalFiles(fileName, filter)
+		}
+		var data []byte
+		if data, err = ioutil.ReadFile(fileName); err == nil {
+			err = add(fileName, data)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return yamlFiles, sources, nil
+}
+
+func readTarArchive(fileName string, gzipped bool, filter FileFilter, add func(string, []byte) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		accepted, err := filter.accepts(name)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		if err := add(fileName+":"+name, data); err != nil {
+			return err
+		}
+	}
+}
+
+func readZipArchive(fileName string, filter FileFilter, add func(string, []byte) error) error {
+	zr, err := zip.OpenReader(fileName)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(zf.Name), "/")
+		accepted, err := filter.accepts(name)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		if err := add(fileName+":"+name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitObjects breaks the content of a file into individual Kubernetes objects.
+// YAML streams are split on "---", List kinds and JSON arrays are expanded into their
+// items and documents that hold nothing but comments are dropped.
+func SplitObjects(fileName string, data []byte) ([]string, []Source, error) {
+	var objects []string
+	var sources []Source
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for index := 0; ; index++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		if isEmptyDocument(doc) {
+			continue
+		}
+		items, err := expandDocument(doc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", Source{File: fileName, Index: index, Item: -1}, err)
+		}
+		if items == nil {
+			objects = append(objects, string(doc))
+			sources = append(sources, Source{File: fileName, Index: index, Item: -1})
+			continue
+		}
+		for i, item := range items {
+			objects = append(objects, item)
+			sources = append(sources, Source{File: fileName, Index: index, Item: i})
+		}
+	}
+	return objects, sources, nil
+}
+
+// expandDocument returns the items of a List document or a JSON array.
+// For any other document it returns nil, so the document is kept as it was written.
+func expandDocument(doc []byte) ([]string, error) {
+	docJson, err := yaml.ToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	if err := json.Unmarshal(docJson, &obj); err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch o := obj.(type) {
+	case []interface{}:
+		items = o
+	case map[string]interface{}:
+		kind, _ := o["kind"].(string)
+		if !strings.HasSuffix(kind, "List") {
+			return nil, nil
+		}
+		var ok bool
+		if items, ok = o["items"].([]interface{}); !ok {
+			return nil, nil
+		}
+		// Items of typed lists (e.g. PodList) come without their own TypeMeta.
+		if kind != "List" {
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					if _, found := m["kind"]; !found {
+						m["kind"] = strings.TrimSuffix(kind, "List")
+					}
+					if _, found := m["apiVersion"]; !found {
+						m["apiVersion"] = o["apiVersion"]
+					}
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("document is not a Kubernetes object")
+	}
+
+	result := []string{}
+	for _, item := range items {
+		itemByte, err := ylib.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		// Lists can be nested, e.g. an array of List objects.
+		nested, err := expandDocument(itemByte)
+		if err != nil {
+			return nil, err
+		}
+		if nested != nil {
+			result = append(result, nested...)
+		} else {
+			result = append(result, string(itemByte))
+		}
+	}
+	return result, nil
+}
+
+func isEmptyDocument(doc []byte) bool {
+	for _, l := range strings.Split(string(doc), "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) != 0 && l != "---" && !strings.HasPrefix(l, "#") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLocalFilesSplitsDocuments(t *testing.T) {
+	yamlFiles, sources, err := ReadLocalFiles("../testdata/multi_document/input", FileFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, len(yamlFiles), len(sources))
+
+	expected := []struct {
+		kind, name string
+		source     Source
+	}{
+		{"ConfigMap", "app-config", Source{File: "../testdata/multi_document/input/bundle.yaml", Index: 1, Item: -1}},
+		{"Service", "app", Source{File: "../testdata/multi_document/input/bundle.yaml", Index: 3, Item: 0}},
+		{"Secret", "app-secret", Source{File: "../testdata/multi_document/input/bundle.yaml", Index: 3, Item: 1}},
+		{"Service", "app-headless", Source{File: "../testdata/multi_document/input/bundle.yaml", Index: 4, Item: 0}},
+		{"ConfigMap", "json-config", Source{File: "../testdata/multi_document/input/objects.json", Index: 0, Item: 0}},
+		{"Secret", "json-secret", Source{File: "../testdata/multi_document/input/objects.json", Index: 0, Item: 1}},
+	}
+	assert.Equal(t, len(expected), len(yamlFiles))
+	for i, e := range expected {
+		if i >= len(yamlFiles) {
+			break
+		}
+		kind, name := getObjectKindAndName(yamlFiles[i])
+		assert.Equal(t, e.kind, kind)
+		assert.Equal(t, e.name, name)
+		assert.Equal(t, e.source, sources[i])
+	}
+}
+
+func TestSplitObjectsSkipsEmptyDocuments(t *testing.T) {
+	objects, sources, err := SplitObjects("empty.yaml", []byte("---\n# nothing here\n---\n\n---\n"))
+	assert.Nil(t, err)
+	assert.Empty(t, objects)
+	assert.Empty(t, sources)
+}
+
+func TestReadLocalFilesWalksDirectories(t *testing.T) {
+	cases := []struct {
+		filter   FileFilter
+		expected []string
+	}{
+		{FileFilter{}, []string{"api", "api-keep", "web", "base"}},
+		{FileFilter{Exclude: []string{"apps/web", "keep.*"}}, []string{"api", "base"}},
+		{FileFilter{Include: []string{"**/*.json"}}, []string{"web"}},
+		{FileFilter{Include: []string{"base/*"}}, []string{"base"}},
+	}
+	for _, c := range cases {
+		yamlFiles, _, err := ReadLocalFiles("../testdata/nested_dirs/input", c.filter)
+		assert.Nil(t, err)
+		var names []string
+		for _, v := range yamlFiles {
+			_, name := getObjectKindAndName(v)
+			names = append(names, name)
+		}
+		assert.Equal(t, c.expected, names)
+	}
+}
+
+func TestReadLocalFilesInvalidPatterns(t *testing.T) {
+	for _, filter := range []FileFilter{{Include: []string{"[z-a].yaml"}}, {Exclude: []string{"apps/[z-a]"}}} {
+		_, _, err := ReadLocalFiles("../testdata/nested_dirs/input", filter)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "invalid pattern")
+		}
+	}
+
+	tmp, err := ioutil.TempDir(os.TempDir(), "ignore")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(tmp, IgnoreFileName), []byte("*.json\n[z-a]/\n"), 0644))
+	_, _, err = ReadLocalFiles(tmp, FileFilter{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), IgnoreFileName+`: invalid pattern "[z-a]"`)
+	}
+}
+
+func TestReadFileFromArchives(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "archive")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	members := []struct {
+		name, data string
+	}{
+		{"manifests/config.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: secret\n"},
+		{"manifests/README.md", "# not a manifest\n"},
+		{"manifests/service.json", `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "service"}}`},
+	}
+	expected := []string{"config", "secret", "service"}
+
+	var tarBuf bytes.Buffer
+	gz := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		assert.Nil(t, tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(m.data))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tw.Close())
+	assert.Nil(t, gz.Close())
+	tarFile := filepath.Join(tmp, "manifests.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(tarFile, tarBuf.Bytes(), 0644))
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(m.data))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zw.Close())
+	zipFile := filepath.Join(tmp, "manifests.zip")
+	assert.Nil(t, ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644))
+
+	for _, archive := range []string{tarFile, zipFile} {
+		yamlFiles, sources, err := ReadFile(archive, FileFilter{})
+		assert.Nil(t, err)
+		var names []string
+		for _, v := range yamlFiles {
+			_, name := getObjectKindAndName(v)
+			names = append(names, name)
+		}
+		assert.Equal(t, expected, names)
+		assert.Equal(t, Source{File: archive + ":manifests/config.yaml", Index: 1, Item: -1}, sources[1])
+	}
+}
+
+func TestReadFileFromStdin(t *testing.T) {
+	defer func(r io.Reader) { Stdin = r }(Stdin)
+	Stdin = strings.NewReader("apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: config\n")
+	yamlFiles, sources, err := ReadFile("-", FileFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, yamlFiles, 1)
+	assert.Equal(t, []Source{{File: "<stdin>", Index: 0, Item: 0}}, sources)
+}
@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// apiResource is a resource found through API discovery.
+type apiResource struct {
+	schema.GroupVersion
+	metav1.APIResource
+}
+
+// serverResources discovers the preferred resources of the server. Groups that fail discovery are
+// left out.
+func serverResources(disc discovery.DiscoveryInterface) ([]*metav1.APIResourceList, error) {
+	resourceLists, err := disc.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	return resourceLists, nil
+}
+
+// findResource resolves a kind, plural or short name, optionally qualified with its group or with
+// its version and group (e.g. "deploy", "ingresses", "CronJob.batch", "deployments.v1.apps"), among
+// resourceLists the way kubectl does.
+func findResource(resourceLists []*metav1.APIResourceList, name string) (apiResource, error) {
+	name = strings.ToLower(name)
+	gvr, gr := schema.ParseResourceArg(name)
+	var found []apiResource
+	// As in kubectl, a group may have dots of its own, so "resource.version.group" is only one of
+	// the readings of a name with two dots.
+	if gvr != nil {
+		found = matchResources(resourceLists, gvr.Resource, gvr.GroupVersion(), true)
+	}
+	if len(found) == 0 {
+		found = matchResources(resourceLists, gr.Resource, schema.GroupVersion{Group: gr.Group}, false)
+	}
+	name = gr.Resource
+	switch len(found) {
+	case 0:
+		return apiResource{}, fmt.Errorf("the server doesn't have a resource type %q", name)
+	case 1:
+		return found[0], nil
+	}
+	// Prefer the core and built-in groups over custom resources, as kubectl does.
+	for _, r := range found {
+		if r.Group == "" {
+			return r, nil
+		}
+	}
+	// extensions only holds old copies of resources that moved to other groups.
+	var current []apiResource
+	for _, r := range found {
+		if r.Group != "extensions" {
+			current = append(current, r)
+		}
+	}
+	if len(current) == 1 {
+		return current[0], nil
+	}
+	var candidates []string
+	for _, r := range found {
+		candidates = append(candidates, r.Name+"."+r.Group)
+	}
+	return apiResource{}, fmt.Errorf("resource type %q is ambiguous, use one of %s", name, strings.Join(candidates, ", "))
+}
+
+// matchResources returns the resources of resourceLists named name, in the group of gv if name was
+// qualified and in its version too if versioned.
+func matchResources(resourceLists []*metav1.APIResourceList, name string, gv schema.GroupVersion, versioned bool) []apiResource {
+	qualified := versioned || len(gv.Group) != 0
+	var found []apiResource
+	for _, list := range resourceLists {
+		listGV, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		if qualified && listGV.Group != gv.Group || versioned && listGV.Version != gv.Version {
+			continue
+		}
+		for _, r := range list.APIResources {
+			// skip subresources like deployments/scale
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			if resourceNameMatches(r, name) {
+				found = append(found, apiResource{GroupVersion: listGV, APIResource: r})
+			}
+		}
+	}
+	return found
+}
+
+func resourceNameMatches(r metav1.APIResource, name string) bool {
+	if r.Name == name || strings.ToLower(r.Kind) == name {
+		return true
+	}
+	for _, s := range r.ShortNames {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the REST path of a named object or, if name is empty, of the collection.
+func (r apiResource) path(namespace, name string) []string {
+	var segments []string
+	if len(r.Group) == 0 {
+		segments = []string{"/api", r.Version}
+	} else {
+		segments = []string{"/apis", r.Group, r.Version}
+	}
+	if r.Namespaced {
+		segments = append(segments, "namespaces", namespace)
+	}
+	segments = append(segments, r.Name)
+	if len(name) != 0 {
+		segments = append(segments, name)
+	}
+	return segments
+}
+
+// getResource fetches the named object, or every object of the kind matching selector if name is empty.
+// The kind is looked up among resourceLists.
+func getResource(disc discovery.DiscoveryInterface, resourceLists []*metav1.APIResourceList, kind, name, namespace, selector string) ([]string, error) {
+	resource, err := findResource(resourceLists, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	req := disc.RESTClient().Get().AbsPath(resource.path(namespace, name)...)
+	if len(name) == 0 && len(selector) != 0 {
+		req = req.Param("labelSelector", selector)
+	}
+	data, err := req.DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]interface{}
+	if len(name) != 0 {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	} else {
+		var list struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		objects = list.Items
+	}
+
+	var yamlFiles []string
+	for _, obj := range objects {
+		// Items of a list come without apiVersion and kind.
+		obj["apiVersion"] = resource.GroupVersion.String()
+		obj["kind"] = resource.Kind
+		delete(obj, "status")
+		dataByte, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		yamlFiles = append(yamlFiles, string(dataByte))
+	}
+	return yamlFiles, nil
+}
+
+// splitResource splits kind/name@namespace. The name is empty if only a kind is given.
+func splitResource(s string, defaultNamespace string) (string, string, string) {
+	namespace := defaultNamespace
+	if len(namespace) == 0 {
+		namespace = apiv1.NamespaceDefault
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s, namespace = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		return s[:i], s[i+1:], namespace
+	}
+	return s, "", namespace
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSplitResource(t *testing.T) {
+	cases := []struct {
+		in, kind, name, namespace string
+	}{
+		{"ingress/web@prod", "ingress", "web", "prod"},
+		{"cronjobs/backup", "cronjobs", "backup", "default"},
+		{"clusterroles.rbac.authorization.k8s.io/admin", "clusterroles.rbac.authorization.k8s.io", "admin", "default"},
+		{"ing@prod", "ing", "", "prod"},
+		{"cj", "cj", "", "default"},
+	}
+	for _, c := range cases {
+		kind, name, namespace := splitResource(c.in, "")
+		assert.Equal(t, []string{c.kind, c.name, c.namespace}, []string{kind, name, namespace})
+	}
+}
+
+func TestResourceNameMatches(t *testing.T) {
+	r := metav1.APIResource{Name: "ingresses", Kind: "Ingress", ShortNames: []string{"ing"}}
+	for _, name := range []string{"ingresses", "ingress", "ing"} {
+		assert.True(t, resourceNameMatches(r, name), name)
+	}
+	assert.False(t, resourceNameMatches(r, "ingresse"))
+}
+
+func TestResourcePath(t *testing.T) {
+	ing := apiResource{
+		GroupVersion: schema.GroupVersion{Group: "extensions", Version: "v1beta1"},
+		APIResource:  metav1.APIResource{Name: "ingresses", Namespaced: true, Kind: "Ingress"},
+	}
+	assert.Equal(t, []string{"/apis", "extensions", "v1beta1", "namespaces", "prod", "ingresses", "web"}, ing.path("prod", "web"))
+	pv := apiResource{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		APIResource:  metav1.APIResource{Name: "persistentvolumes", Kind: "PersistentVolume"},
+	}
+	assert.Equal(t, []string{"/api", "v1", "persistentvolumes"}, pv.path("prod", ""))
+}
+
+var testResources = []*metav1.APIResourceList{
+	{GroupVersion: "v1", APIResources: []metav1.APIResource{
+		{Name: "events", Namespaced: true, Kind: "Event", ShortNames: []string{"ev"}},
+	}},
+	{GroupVersion: "events.k8s.io/v1", APIResources: []metav1.APIResource{
+		{Name: "events", Namespaced: true, Kind: "Event", ShortNames: []string{"ev"}},
+	}},
+	{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{
+		{Name: "deployments", Namespaced: true, Kind: "Deployment", ShortNames: []string{"deploy"}},
+	}},
+	{GroupVersion: "extensions/v1beta1", APIResources: []metav1.APIResource{
+		{Name: "ingresses", Namespaced: true, Kind: "Ingress", ShortNames: []string{"ing"}},
+	}},
+	{GroupVersion: "networking.k8s.io/v1", APIResources: []metav1.APIResource{
+		{Name: "ingresses", Namespaced: true, Kind: "Ingress", ShortNames: []string{"ing"}},
+		{Name: "ingresses/status", Namespaced: true, Kind: "Ingress"},
+	}},
+	{GroupVersion: "example.com/v1", APIResources: []metav1.APIResource{
+		{Name: "widgets", Namespaced: true, Kind: "Widget"},
+	}},
+	{GroupVersion: "other.example.com/v1", APIResources: []metav1.APIResource{
+		{Name: "widgets", Namespaced: true, Kind: "Widget"},
+	}},
+}
+
+func TestFindResource(t *testing.T) {
+	cases := []struct {
+		name, groupVersion string
+	}{
+		{"ev", "v1"},
+		{"Event.events.k8s.io", "events.k8s.io/v1"},
+		{"ing", "networking.k8s.io/v1"},
+		{"ingresses.extensions", "extensions/v1beta1"},
+		{"deployments.v1.apps", "apps/v1"},
+		{"Ingress.v1.networking.k8s.io", "networking.k8s.io/v1"},
+		// Read as version "other" of example.com first, which has none.
+		{"widgets.other.example.com", "other.example.com/v1"},
+	}
+	for _, c := range cases {
+		r, err := findResource(testResources, c.name)
+		if assert.Nil(t, err, c.name) {
+			assert.Equal(t, c.groupVersion, r.GroupVersion.String(), c.name)
+		}
+	}
+	_, err := findResource(testResources, "widget")
+	assert.EqualError(t, err, `resource type "widget" is ambiguous, use one of widgets.example.com, widgets.other.example.com`)
+	_, err = findResource(testResources, "deployments.v1beta2.apps")
+	assert.EqualError(t, err, `the server doesn't have a resource type "deployments"`)
+	_, err = findResource(testResources, "gadgets")
+	assert.EqualError(t, err, `the server doesn't have a resource type "gadgets"`)
+}
+
+func TestExtractResources(t *testing.T) {
+	kubeClient := newFakeClientset()
+	kubeClient.resources = testResources
+	ko := KubeObjects{Resources: []string{"gadgets/a", "gizmos/b@prod", "ingress"}, Concurrency: 3}
+	_, err := ko.Extract(kubeClient)
+	errs, ok := err.(ExtractErrors)
+	if assert.True(t, ok) && assert.Len(t, errs, 3) {
+		assert.EqualError(t, errs[0].Err, `the server doesn't have a resource type "gadgets"`)
+		assert.EqualError(t, errs[1].Err, `the server doesn't have a resource type "gizmos"`)
+		// A kind alone would read every object of the kind in the namespace.
+		assert.EqualError(t, errs[2].Err, "give a name, --selector or --all-in-namespace to read objects of ingress")
+	}
+	assert.Equal(t, 1, kubeClient.discoveries)
+}
@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// SanitizeRules lists the cluster generated noise stripped from objects before templates are generated.
+type SanitizeRules struct {
+	// Annotations are removed from every annotations map of an object, including pod templates.
+	Annotations []string `json:"annotations,omitempty"`
+	// Labels are removed from every labels and matchLabels map of an object, including pod
+	// templates and label selectors.
+	Labels []string `json:"labels,omitempty"`
+	// Fields maps a kind, or "*" for every kind, to the dot separated paths of fields to remove.
+	// A "[]" suffix steps into every element of a list, e.g. spec.ports[].nodePort.
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// DefaultSanitizeRules are always applied. Besides these, Services lose their allocated
+// clusterIP(s) (headless Services keep "None") and healthCheckNodePort, Services exported from a
+// cluster lose the nodePorts not set in kubectl.kubernetes.io/last-applied-configuration, and PVCs
+// bound by the controller lose spec.volumeName.
+var DefaultSanitizeRules = SanitizeRules{
+	Annotations: []string{
+		"kubectl.kubernetes.io/last-applied-configuration",
+		"kubernetes.io/change-cause",
+		"deployment.kubernetes.io/desired-replicas",
+		"deployment.kubernetes.io/max-replicas",
+		"deployment.kubernetes.io/revision",
+		"deprecated.daemonset.template.generation",
+		"pv.kubernetes.io/bind-completed",
+		"pv.kubernetes.io/bound-by-controller",
+		"pv.kubernetes.io/provisioned-by",
+		"volume.beta.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/selected-node",
+		"control-plane.alpha.kubernetes.io/leader",
+		"autoscaling.alpha.kubernetes.io/conditions",
+		"autoscaling.alpha.kubernetes.io/current-metrics",
+		"endpoints.kubernetes.io/last-change-trigger-time",
+		"kubernetes.io/service-account.uid",
+	},
+	Labels: []string{
+		"controller-uid",
+		"batch.kubernetes.io/controller-uid",
+		"pod-template-hash",
+		"pod-template-generation",
+		"controller-revision-hash",
+		"statefulset.kubernetes.io/pod-name",
+	},
+	Fields: map[string][]string{
+		"*": {
+			"metadata.managedFields",
+			"metadata.ownerReferences",
+			"metadata.finalizers",
+			"metadata.selfLink",
+			"metadata.uid",
+			"metadata.resourceVersion",
+			"metadata.generation",
+			"metadata.creationTimestamp",
+			"metadata.deletionTimestamp",
+			"metadata.deletionGracePeriodSeconds",
+			"status",
+		},
+		"PersistentVolume": {
+			"spec.claimRef.uid",
+			"spec.claimRef.resourceVersion",
+		},
+		// The priority of pods is resolved from their priorityClassName on admission, and rejected
+		// if it is set and doesn't match.
+		"Pod":                   {"spec.priority"},
+		"ReplicationController": {"spec.template.spec.priority"},
+		"Deployment":            {"spec.template.spec.priority"},
+		"DaemonSet":             {"spec.template.spec.priority"},
+		"ReplicaSet":            {"spec.template.spec.priority"},
+		"StatefulSet":           {"spec.template.spec.priority"},
+		"Job":                   {"spec.template.spec.priority"},
+		"CronJob":               {"spec.jobTemplate.spec.template.spec.priority"},
+	},
+}
+
+// kindSanitizers strip fields that are only noise under some condition.
+var kindSanitizers = map[string]func(obj map[string]interface{}){
+	"Service":               sanitizeService,
+	"PersistentVolumeClaim": sanitizePersistentVolumeClaim,
+}
+
+// ReadSanitizeConfig reads extra SanitizeRules from a yaml or json file.
+func ReadSanitizeConfig(fileName string) (SanitizeRules, error) {
+	var rules SanitizeRules
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return rules, err
+	}
+	err = yaml.Unmarshal(data, &rules)
+	return rules, err
+}
+
+// Merge returns the rules of r extended by other.
+func (r SanitizeRules) Merge(other SanitizeRules) SanitizeRules {
+	merged := SanitizeRules{
+		Annotations: append(append([]string{}, r.Annotations...), other.Annotations...),
+		Labels:      append(append([]string{}, r.Labels...), other.Labels...),
+		Fields:      map[string][]string{},
+	}
+	for kind, paths := range r.Fields {
+		merged.Fields[kind] = append(merged.Fields[kind], paths...)
+	}
+	for kind, paths := range other.Fields {
+		merged.Fields[kind] = append(merged.Fields[kind], paths...)
+	}
+	return merged
+}
+
+// Sanitize strips the fields matched by r from obj, an object decoded from json.
+func (r SanitizeRules) Sanitize(obj map[string]interface{}) {
+	kind, _ := obj["kind"].(string)
+	// Kind specific rules may look at annotations, so they run first.
+	if sanitize, ok := kindSanitizers[kind]; ok {
+		sanitize(obj)
+	}
+	for _, path := range append(r.Fields["*"], r.Fields[kind]...) {
+		removeField(obj, strings.Split(path, "."))
+	}
+	removeMapKeys(obj, r.Annotations, r.Labels)
+}
+
+// SanitizeJSON applies r to a json encoded object.
+func (r SanitizeRules) SanitizeJSON(data []byte) ([]byte, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	r.Sanitize(obj)
+	return json.Marshal(obj)
+}
+
+func removeField(obj map[string]interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	key := path[0]
+	if !strings.HasSuffix(key, "[]") {
+		if len(path) == 1 {
+			delete(obj, key)
+			return
+		}
+		if child, ok := obj[key].(map[string]interface{}); ok {
+			removeField(child, path[1:])
+		}
+		return
+	}
+	items, ok := obj[strings.TrimSuffix(key, "[]")].([]interface{})
+	if !ok {
+		return
+	}
+	for _, item := range items {
+		if child, ok := item.(map[string]interface{}); ok {
+			removeField(child, path[1:])
+		}
+	}
+}
+
+// removeMapKeys walks obj and deletes the given keys from every annotations, labels and matchLabels map.
+func removeMapKeys(obj interface{}, annotations, labels []string) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range o {
+			m, isMap := v.(map[string]interface{})
+			switch {
+			case isMap && k == "annotations":
+				deleteKeys(m, annotations)
+			case isMap && (k == "labels" || k == "matchLabels"):
+				deleteKeys(m, labels)
+			default:
+				removeMapKeys(v, annotations, labels)
+				continue
+			}
+			if len(m) == 0 {
+				delete(o, k)
+			}
+		}
+	case []interface{}:
+		for _, v := range o {
+			removeMapKeys(v, annotations, labels)
+		}
+	}
+}
+
+func deleteKeys(m map[string]interface{}, keys []string) {
+	for _, k := range keys {
+		delete(m, k)
+	}
+}
+
+func sanitizeService(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if spec["clusterIP"] != "None" {
+		delete(spec, "clusterIP")
+		delete(spec, "clusterIPs")
+	}
+	delete(spec, "healthCheckNodePort")
+
+	// Node ports are allocated by the cluster, unless they are part of the applied configuration.
+	// Those of local manifests are set by hand.
+	if !exported(obj) {
+		return
+	}
+	applied := map[string]bool{}
+	var lastApplied struct {
+		Spec struct {
+			Ports []struct {
+				Port     int32 `json:"port"`
+				NodePort int32 `json:"nodePort"`
+			} `json:"ports"`
+		} `json:"spec"`
+	}
+	if s, ok := annotation(obj, "kubectl.kubernetes.io/last-applied-configuration"); ok {
+		if err := json.Unmarshal([]byte(s), &lastApplied); err == nil {
+			for _, p := range lastApplied.Spec.Ports {
+				if p.NodePort != 0 {
+					applied[portKey(p.Port, p.NodePort)] = true
+				}
+			}
+		}
+	}
+	ports, _ := spec["ports"].([]interface{})
+	for _, p := range ports {
+		port, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		number, _ := port["port"].(float64)
+		nodePort, _ := port["nodePort"].(float64)
+		if !applied[portKey(int32(number), int32(nodePort))] {
+			delete(port, "nodePort")
+		}
+	}
+}
+
+// exported tells whether obj was read from a cluster rather than written by hand.
+func exported(obj map[string]interface{}) bool {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	for _, k := range []string{"uid", "resourceVersion", "managedFields"} {
+		if _, ok := meta[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func portKey(port, nodePort int32) string {
+	return fmt.Sprintf("%d:%d", port, nodePort)
+}
+
+func sanitizePersistentVolumeClaim(obj map[string]interface{}) {
+	if v, _ := annotation(obj, "pv.kubernetes.io/bound-by-controller"); v != "yes" {
+		return
+	}
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		delete(spec, "volumeName")
+	}
+}
+
+func annotation(obj map[string]interface{}, key string) (string, bool) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	v, ok := annotations[key].(string)
+	return v, ok
+}
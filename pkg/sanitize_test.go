@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func sanitizeFile(t *testing.T, rules SanitizeRules, fileName string) string {
+	data, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	obj := map[string]interface{}{}
+	assert.Nil(t, yaml.Unmarshal(data, &obj))
+	rules.Sanitize(obj)
+	out, err := yaml.Marshal(obj)
+	assert.Nil(t, err)
+	return string(out)
+}
+
+func TestSanitizeDefaultRules(t *testing.T) {
+	for _, name := range []string{"deployment", "service", "headless_service", "local_service", "pvc"} {
+		actual := sanitizeFile(t, DefaultSanitizeRules, "../testdata/sanitize/input/"+name+".yaml")
+		expected, err := ioutil.ReadFile("../testdata/sanitize/output/" + name + ".yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), actual, name)
+	}
+}
+
+func TestSanitizeConfigRules(t *testing.T) {
+	extra, err := ReadSanitizeConfig("../testdata/sanitize/rules.yaml")
+	assert.Nil(t, err)
+	actual := sanitizeFile(t, DefaultSanitizeRules.Merge(extra), "../testdata/sanitize/input/deployment.yaml")
+	expected, err := ioutil.ReadFile("../testdata/sanitize/output/deployment_rules.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), actual)
+}
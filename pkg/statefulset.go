@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	apps "k8s.io/client-go/pkg/apis/apps/v1beta1"
+)
+
+// statefulSet holds the fields of a StatefulSet in any apps version, including the ones added to the
+// spec after apps/v1beta1.
+type statefulSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              statefulSetSpec `json:"spec,omitempty"`
+}
+
+type statefulSetSpec struct {
+	apps.StatefulSetSpec `json:",inline"`
+	// VolumeClaimTemplates keeps the claim specs as they are, their fields changed over time.
+	VolumeClaimTemplates []volumeClaimTemplate      `json:"volumeClaimTemplates,omitempty"`
+	PodManagementPolicy  string                     `json:"podManagementPolicy,omitempty"`
+	UpdateStrategy       *statefulSetUpdateStrategy `json:"updateStrategy,omitempty"`
+}
+
+type statefulSetUpdateStrategy struct {
+	Type          string `json:"type,omitempty"`
+	RollingUpdate *struct {
+		Partition      *int32              `json:"partition,omitempty"`
+		MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	} `json:"rollingUpdate,omitempty"`
+}
+
+type volumeClaimTemplate struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              map[string]interface{} `json:"spec,omitempty"`
+}
+
+// statefulSetStrategyValues returns the podManagementPolicy and updateStrategy values of spec, defaulted
+// as the apiVersion of the StatefulSet does, so that they keep their meaning in other versions.
+func statefulSetStrategyValues(apiVersion string, spec statefulSetSpec) (string, map[string]interface{}) {
+	policy := spec.PodManagementPolicy
+	if len(policy) == 0 {
+		policy = "OrderedReady"
+	}
+	// RollingUpdate became the default in apps/v1beta2.
+	strategy := map[string]interface{}{
+		Type: "OnDelete",
+	}
+	if apiVersion == "apps/v1beta2" || apiVersion == "apps/v1" {
+		strategy[Type] = "RollingUpdate"
+	}
+	var partition int32
+	if s := spec.UpdateStrategy; s != nil {
+		if len(s.Type) != 0 {
+			strategy[Type] = s.Type
+		}
+		if s.RollingUpdate != nil {
+			if s.RollingUpdate.Partition != nil {
+				partition = *s.RollingUpdate.Partition
+			}
+			if u := s.RollingUpdate.MaxUnavailable; u != nil {
+				if u.Type == intstr.String {
+					strategy[MaxUnavailable] = u.StrVal
+				} else {
+					strategy[MaxUnavailable] = u.IntVal
+				}
+			}
+		}
+	}
+	strategy[Partition] = partition
+	return policy, strategy
+}
+
+// statefulSetStrategyTemplate renders the podManagementPolicy and updateStrategy of the StatefulSet key
+// as fields of its spec.
+func statefulSetStrategyTemplate(key string) string {
+	values := fmt.Sprintf(".Values.%s.%s", key, UpdateStrategy)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: {{ .Values.%s.%s }}\n", PodManagementPolicy, key, PodManagementPolicy)
+	fmt.Fprintf(&buf, "%s:\n", UpdateStrategy)
+	fmt.Fprintf(&buf, "  type: {{ %s.%s }}\n", values, Type)
+	fmt.Fprintf(&buf, "  {{- if eq %s.%s \"RollingUpdate\" }}\n", values, Type)
+	buf.WriteString("  rollingUpdate:\n")
+	fmt.Fprintf(&buf, "    partition: {{ %s.%s }}\n", values, Partition)
+	fmt.Fprintf(&buf, "    {{- if %s.%s }}\n", values, MaxUnavailable)
+	fmt.Fprintf(&buf, "    maxUnavailable: {{ %s.%s }}\n", values, MaxUnavailable)
+	buf.WriteString("    {{- end }}\n")
+	buf.WriteString("  {{- end }}\n")
+	return buf.String()
+}
+
+// volumeClaimTemplatesTemplate renders the claim templates as fields of the StatefulSet spec, with their
+// size, storage class, access modes and annotations taken from persistence.<claim>. A storageClass
+// of "-" sets an empty storageClassName, which disables dynamic provisioning.
+func volumeClaimTemplatesTemplate(claims []volumeClaimTemplate) (string, map[string]interface{}) {
+	persistence := make(map[string]interface{}, 0)
+	var buf bytes.Buffer
+	buf.WriteString("volumeClaimTemplates:\n")
+	for _, claim := range claims {
+		key := generateSafeKey(claim.Name)
+		values := fmt.Sprintf(".Values.%s.%s", Persistence, key)
+		claimValue := make(map[string]interface{}, 0)
+
+		spec := claim.Spec
+		if spec == nil {
+			spec = make(map[string]interface{})
+		}
+		accessModes, _ := spec["accessModes"].([]interface{})
+		if len(accessModes) == 0 {
+			accessModes = []interface{}{"ReadWriteOnce"}
+		}
+		claimValue[AccessModes] = accessModes
+		claimValue[StorageClass] = ""
+		if storageClass, ok := spec["storageClassName"].(string); ok {
+			if len(storageClass) == 0 {
+				storageClass = "-"
+			}
+			claimValue[StorageClass] = storageClass
+		}
+		resources, _ := spec["resources"].(map[string]interface{})
+		if resources == nil {
+			resources = make(map[string]interface{})
+		}
+		requests, _ := resources["requests"].(map[string]interface{})
+		if requests == nil {
+			requests = make(map[string]interface{})
+		}
+		claimValue[Size] = ""
+		if size, ok := requests["storage"]; ok {
+			claimValue[Size] = size
+		}
+		sizeTemplate := fmt.Sprintf("{{ %s.%s | quote }}", values, Size)
+		requests["storage"] = sizeTemplate
+		resources["requests"] = requests
+		spec["resources"] = resources
+		delete(spec, "accessModes")
+		delete(spec, "storageClassName")
+		if len(claim.Annotations) != 0 {
+			claimValue[Annotations] = claim.Annotations
+		}
+		persistence[key] = claimValue
+
+		buf.WriteString("- metadata:\n")
+		fmt.Fprintf(&buf, "    name: %s\n", claim.Name)
+		if len(claim.Labels) != 0 {
+			buf.WriteString(indentYaml(map[string]interface{}{"labels": claim.Labels}, "    "))
+		}
+		fmt.Fprintf(&buf, "    {{- with %s.%s }}\n", values, Annotations)
+		buf.WriteString("    annotations: {{- toYaml . | nindent 8 }}\n")
+		buf.WriteString("    {{- end }}\n")
+		buf.WriteString("  spec:\n")
+		fmt.Fprintf(&buf, "    accessModes: {{- toYaml %s.%s | nindent 8 }}\n", values, AccessModes)
+		fmt.Fprintf(&buf, "    {{- if %s.%s }}\n", values, StorageClass)
+		fmt.Fprintf(&buf, "    {{- if eq \"-\" %s.%s }}\n", values, StorageClass)
+		buf.WriteString("    storageClassName: \"\"\n")
+		buf.WriteString("    {{- else }}\n")
+		fmt.Fprintf(&buf, "    storageClassName: {{ %s.%s | quote }}\n", values, StorageClass)
+		buf.WriteString("    {{- end }}\n")
+		buf.WriteString("    {{- end }}\n")
+		buf.WriteString(strings.Replace(indentYaml(spec, "    "), "'"+sizeTemplate+"'", sizeTemplate, 1))
+	}
+	return buf.String(), persistence
+}
+
+// indentYaml marshals obj and indents every line.
+func indentYaml(obj interface{}, indent string) string {
+	data, err := ylib.Marshal(obj)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, l := range strings.Split(string(data), "\n") {
+		if len(l) != 0 {
+			buf.WriteString(indent + l + "\n")
+		}
+	}
+	return buf.String()
+}
@@ -16,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	v1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	batchv2 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 )
@@ -93,6 +94,27 @@ func generateTemplateDeplymentSpec(dcSpec extensions.DeploymentSpec, dcSpecStr s
 	return templateDeployment, value
 }
 
+func generateTemplateForCronJobSpec(cronJobSpec batchv2.CronJobSpec, cronJobSpecStr string, key string, value map[string]interface{}) (string, map[string]interface{}) {
+	templateCronJob := updateIntParamAsStringInTemplate(cronJobSpecStr, key, Suspend)
+
+	if cronJobSpec.StartingDeadlineSeconds != nil {
+		templateCronJob = updateIntParamAsStringInTemplate(templateCronJob, key, StartingDeadlineSeconds)
+		value[StartingDeadlineSeconds] = cronJobSpec.StartingDeadlineSeconds
+	}
+
+	if cronJobSpec.SuccessfulJobsHistoryLimit != nil {
+		templateCronJob = updateIntParamAsStringInTemplate(templateCronJob, key, SuccessfulJobsHistoryLimit)
+		value[SuccessfulJobsHistoryLimit] = cronJobSpec.SuccessfulJobsHistoryLimit
+	}
+
+	if cronJobSpec.FailedJobsHistoryLimit != nil {
+		templateCronJob = updateIntParamAsStringInTemplate(templateCronJob, key, FailedJobsHistoryLimit)
+		value[FailedJobsHistoryLimit] = cronJobSpec.FailedJobsHistoryLimit
+	}
+
+	return templateCronJob, value
+}
+
 func updateIntParamAsStringInTemplate(spec string, key string, replace string) string {
 	str := strings.Split(spec, "\n")
 	var tpl bytes.Buffer
@@ -116,7 +138,10 @@ func updateIntParamAsStringInTemplate(spec string, key string, replace string) s
 }
 
 func generateTemplateForPodSpec(podSpec apiv1.PodSpec, key string, value map[string]interface{}) apiv1.PodSpec {
-	podSpec.Containers = generateTemplateForContainer(podSpec.Containers, key, value)
+	podSpec.Containers = generateTemplateForContainer(podSpec.Containers, Containers, key, value)
+	if len(podSpec.InitContainers) != 0 {
+		podSpec.InitContainers = generateTemplateForContainer(podSpec.InitContainers, InitContainers, key, value)
+	}
 	if len(podSpec.Hostname) != 0 {
 		value[HostName] = podSpec.Hostname
 		podSpec.Hostname = fmt.Sprintf("{{.Values.%s.%s}}", key, HostName)
@@ -130,8 +155,13 @@ func generateTemplateForPodSpec(podSpec apiv1.PodSpec, key string, value map[str
 		podSpec.NodeName = fmt.Sprintf("{{.Values.%s.%s}}", key, Nodename)
 	}
 	if len(podSpec.ServiceAccountName) != 0 {
-		value[ServiceAccountName] = podSpec.ServiceAccountName
-		podSpec.ServiceAccountName = fmt.Sprintf("{{.Values.%s.%s}}", key, ServiceAccountName)
+		if checkIfNameExist(podSpec.ServiceAccountName, "ServiceAccount") {
+			podSpec.ServiceAccountName = serviceAccountNameTemplate(podSpec.ServiceAccountName)
+			podSpec.DeprecatedServiceAccount = ""
+		} else {
+			value[ServiceAccountName] = podSpec.ServiceAccountName
+			podSpec.ServiceAccountName = fmt.Sprintf("{{.Values.%s.%s}}", key, ServiceAccountName)
+		}
 	}
 	if len(string(podSpec.RestartPolicy)) != 0 {
 		value[RestartPolicy] = string(podSpec.RestartPolicy)
@@ -151,9 +181,106 @@ func generateTemplateForPodSpec(podSpec apiv1.PodSpec, key string, value map[str
 
 	}
 
+	// The scheduling fields are rendered from values by addPodSpecFields. The fields newer than
+	// apiv1.PodSpec are set by addUnknownFields.
+	nodeSelector := podSpec.NodeSelector
+	if nodeSelector == nil {
+		nodeSelector = make(map[string]string)
+	}
+	value[NodeSelector] = nodeSelector
+	tolerations := podSpec.Tolerations
+	if tolerations == nil {
+		tolerations = []apiv1.Toleration{}
+	}
+	value[Tolerations] = tolerations
+	if podSpec.Affinity != nil {
+		if a := podSpec.Affinity.PodAffinity; a != nil {
+			modifyPodAffinityTerms(a.RequiredDuringSchedulingIgnoredDuringExecution, a.PreferredDuringSchedulingIgnoredDuringExecution)
+		}
+		if a := podSpec.Affinity.PodAntiAffinity; a != nil {
+			modifyPodAffinityTerms(a.RequiredDuringSchedulingIgnoredDuringExecution, a.PreferredDuringSchedulingIgnoredDuringExecution)
+		}
+	}
+	value[Affinity] = toValue(podSpec.Affinity)
+	value[TopologySpreadConstraints] = []interface{}{}
+	value[PriorityClassName] = ""
+	value[RuntimeClassName] = ""
+	podSpec.NodeSelector = nil
+	podSpec.Tolerations = nil
+	podSpec.Affinity = nil
+
 	return podSpec
 }
 
+// modifyPodAffinityTerms prefixes the labels the terms select that the workloads of the chart prefix
+// with the release name.
+func modifyPodAffinityTerms(required []apiv1.PodAffinityTerm, preferred []apiv1.WeightedPodAffinityTerm) {
+	for _, t := range required {
+		modifyPodSelector(t.LabelSelector)
+	}
+	for _, t := range preferred {
+		modifyPodSelector(t.PodAffinityTerm.LabelSelector)
+	}
+}
+
+// schedulingValues converts the fields of a pod spec newer than apiv1.PodSpec that addPodSpecFields
+// renders from values, following the release name prefix of the pod labels and PriorityClasses of
+// the chart.
+func schedulingValues(fields map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	if constraints, ok := fields[TopologySpreadConstraints].([]interface{}); ok {
+		for _, c := range constraints {
+			constraint, _ := c.(map[string]interface{})
+			if constraint == nil || constraint["labelSelector"] == nil {
+				continue
+			}
+			data, err := json.Marshal(constraint["labelSelector"])
+			if err != nil {
+				log.Fatal(err)
+			}
+			selector := metav1.LabelSelector{}
+			if err := json.Unmarshal(data, &selector); err != nil {
+				log.Fatal(err)
+			}
+			modifyPodSelector(&selector)
+			constraint["labelSelector"] = toValue(selector)
+		}
+		values[TopologySpreadConstraints] = constraints
+	}
+	if name, ok := fields[PriorityClassName].(string); ok {
+		if !PreserveName && checkIfNameExist(name, "PriorityClass") {
+			name = fmt.Sprintf(`{{ template "fullname" . }}-%s`, name)
+		}
+		values[PriorityClassName] = name
+	}
+	if name, ok := fields[RuntimeClassName].(string); ok {
+		values[RuntimeClassName] = name
+	}
+	return values
+}
+
+// schedulingTemplate renders the scheduling fields of the pod spec of key, whose fields are indented
+// by indent. Affinities, spread constraints and priority classes may refer to the release name.
+func schedulingTemplate(key string, indent int) string {
+	var buf bytes.Buffer
+	for _, field := range []string{NodeSelector, Tolerations, Affinity, TopologySpreadConstraints} {
+		fmt.Fprintf(&buf, "{{- with .Values.%s.%s }}\n", key, field)
+		if field == Affinity || field == TopologySpreadConstraints {
+			fmt.Fprintf(&buf, "%s: {{- tpl (toYaml .) $ | nindent %d }}\n", field, indent+2)
+		} else {
+			fmt.Fprintf(&buf, "%s: {{- toYaml . | nindent %d }}\n", field, indent+2)
+		}
+		buf.WriteString("{{- end }}\n")
+	}
+	fmt.Fprintf(&buf, "{{- with .Values.%s.%s }}\n", key, PriorityClassName)
+	fmt.Fprintf(&buf, "%s: {{ tpl . $ }}\n", PriorityClassName)
+	buf.WriteString("{{- end }}\n")
+	fmt.Fprintf(&buf, "{{- with .Values.%s.%s }}\n", key, RuntimeClassName)
+	fmt.Fprintf(&buf, "%s: {{ . }}\n", RuntimeClassName)
+	buf.WriteString("{{- end }}\n")
+	return buf.String()
+}
+
 func generateTemplateForHorizontalPodAutoscaler(hpaSpec v1.HorizontalPodAutoscalerSpec, hpaSpecStr, key string, value map[string]interface{}) (string, map[string]interface{}) {
 	templateHpa := hpaSpecStr
 
@@ -346,7 +473,23 @@ func generateTemplateForVolume(volumes []apiv1.Volume, key string, value map[str
 	return volumeTemplate, persistence
 }
 
-func generateTemplateForContainer(containers []apiv1.Container, key string, value map[string]interface{}) []apiv1.Container {
+// containerValues returns the path and the values of the containers of list, containers or
+// initContainers, of the object key. Init containers have their own values, as they may have the name
+// of a container.
+func containerValues(key string, list string, value map[string]interface{}) (string, map[string]interface{}) {
+	if list != InitContainers {
+		return key, value
+	}
+	values, _ := value[InitContainers].(map[string]interface{})
+	if values == nil {
+		values = make(map[string]interface{}, 0)
+		value[InitContainers] = values
+	}
+	return key + "." + InitContainers, values
+}
+
+func generateTemplateForContainer(containers []apiv1.Container, list string, key string, value map[string]interface{}) []apiv1.Container {
+	key, value = containerValues(key, list, value)
 	result := make([]apiv1.Container, len(containers))
 	for i, container := range containers {
 		containterValue := make(map[string]interface{}, 0)
@@ -379,12 +522,105 @@ func generateTemplateForContainer(containers []apiv1.Container, key string, valu
 			}
 		}
 
+		// Resources, probes and lifecycle hooks are rendered from values by addContainerFields.
+		containterValue[Resources] = toValue(container.Resources)
+		container.Resources = apiv1.ResourceRequirements{}
+		if container.LivenessProbe != nil {
+			containterValue[LivenessProbe] = probeValue(container.LivenessProbe)
+			container.LivenessProbe = nil
+		}
+		if container.ReadinessProbe != nil {
+			containterValue[ReadinessProbe] = probeValue(container.ReadinessProbe)
+			container.ReadinessProbe = nil
+		}
+		if container.Lifecycle != nil {
+			containterValue[Lifecycle] = toValue(container.Lifecycle)
+			container.Lifecycle = nil
+		}
+		if len(container.Ports) != 0 {
+			containterValue[Ports] = containerPortValues(container.Ports)
+		}
+
 		result[i] = container
 		value[generateSafeKey(container.Name)] = containterValue
 	}
 	return result
 }
 
+// toValue returns obj as it is marshalled, to be rendered with toYaml.
+func toValue(obj interface{}) map[string]interface{} {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		log.Fatal(err)
+	}
+	if value == nil {
+		value = make(map[string]interface{})
+	}
+	return value
+}
+
+// probeValue returns the value of a probe, turned on and off with enabled.
+func probeValue(probe interface{}) map[string]interface{} {
+	value := toValue(probe)
+	value[Enabled] = true
+	return value
+}
+
+// addPodSpecFields renders the fields of the pod spec found at path that are rendered with toYaml
+// from values.
+func addPodSpecFields(template string, key string, podSpec apiv1.PodSpec, value map[string]interface{}, path ...string) string {
+	template = addContainerFields(template, Containers, key, podSpec.Containers, value)
+	template = addContainerFields(template, InitContainers, key, podSpec.InitContainers, value)
+	// The yaml is indented by two spaces a level.
+	return insertAt(template, schedulingTemplate(key, 2*len(path)), path...)
+}
+
+// addContainerFields renders the resources, probes, lifecycle hooks and container ports of the
+// containers of list from their values.
+func addContainerFields(template string, list string, key string, containers []apiv1.Container, value map[string]interface{}) string {
+	if len(containers) == 0 {
+		return template
+	}
+	key, value = containerValues(key, list, value)
+	for _, container := range containers {
+		containerKey := generateSafeKey(container.Name)
+		containerValue, _ := value[containerKey].(map[string]interface{})
+		template = insertIntoContainer(template, list, container.Name, func(indent int) string {
+			return containerFieldsTemplate(key, containerKey, containerValue, indent)
+		})
+		if len(container.Ports) != 0 {
+			template = templateContainerPorts(template, list, container.Name, fmt.Sprintf(".Values.%s.%s.%s", key, containerKey, Ports), container.Ports)
+		}
+	}
+	return template
+}
+
+// containerFieldsTemplate renders the fields of containerValue that are rendered with toYaml, for a
+// container whose values are at key and whose fields are indented by indent.
+func containerFieldsTemplate(key string, containerKey string, containerValue map[string]interface{}, indent int) string {
+	var buf bytes.Buffer
+	for _, field := range []string{Resources, LivenessProbe, ReadinessProbe, StartupProbe, Lifecycle} {
+		if _, ok := containerValue[field]; !ok {
+			continue
+		}
+		values := fmt.Sprintf(".Values.%s.%s.%s", key, containerKey, field)
+		switch field {
+		case LivenessProbe, ReadinessProbe, StartupProbe:
+			fmt.Fprintf(&buf, "{{- if %s.%s }}\n", values, Enabled)
+			fmt.Fprintf(&buf, "%s: {{- toYaml (omit %s %q) | nindent %d }}\n", field, values, Enabled, indent+2)
+		default:
+			fmt.Fprintf(&buf, "{{- with %s }}\n", values)
+			fmt.Fprintf(&buf, "%s: {{- toYaml . | nindent %d }}\n", field, indent+2)
+		}
+		buf.WriteString("{{- end }}\n")
+	}
+	return buf.String()
+}
+
 func generateTemplateForLables(labels map[string]string) map[string]string { // Add labels needed for chart
 	if labels == nil {
 		labels = make(map[string]string, 0)
@@ -440,7 +676,6 @@ func addTemplateImageValue(containerName string, image string, key string, conta
 		containerValue[Image] = image
 		containerValue[ImageTag] = "latest"
 	}
-	key = generateSafeKey(key)
 	imageNameTemplate := fmt.Sprintf("{{.Values.%s.%s.%s}}", key, containerName, Image)
 	imageTagTemplate := fmt.Sprintf("{{.Values.%s.%s.%s}}", key, containerName, ImageTag)
 	imageTemplate := fmt.Sprintf("%s:%s", imageNameTemplate, imageTagTemplate)
@@ -448,9 +683,7 @@ func addTemplateImageValue(containerName string, image string, key string, conta
 }
 
 func addVolumeToTemplateForPod(templatePod string, templatevolumes string) string {
-	templatevolumes = makeSpaceForVolume(templatevolumes, "  ")
-	template := addVolumeInPodTemplate(templatePod, templatevolumes)
-	return template
+	return addVolumeAt(templatePod, templatevolumes, "spec")
 }
 
 func removeEmptyFields(temp string) string {
@@ -562,58 +795,87 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
-func makeSpaceForVolume(templatevolumes string, space string) string {
-	s := space + "volumes:\n"
-	str := strings.Split(templatevolumes, "\n")
-	for _, l := range str {
-		if len(l) == 0 {
-			continue
-		}
-		s = s + space + l + "\n"
-	}
-	return s
+func addVolumeToTemplate(rc string, volumes string) string {
+	return addVolumeAt(rc, volumes, "spec", "template", "spec")
 }
 
-func addVolumeInPodTemplate(pod string, volume string) string {
-	str := strings.Split(pod, "\n")
-	templateForPod := ""
-	for _, l := range str {
+// addVolumeAt inserts volumes into the pod spec found at path, e.g. spec.jobTemplate.spec.template.spec
+// of a CronJob.
+func addVolumeAt(template string, volumes string, path ...string) string {
+	return insertAt(template, "volumes:\n"+volumes, path...)
+}
+
+// insertAt inserts the yaml block as fields of the map found at path. The yaml is walked by
+// indentation, so any nesting depth works.
+func insertAt(template string, block string, path ...string) string {
+	type entry struct {
+		indent int
+		key    string
+	}
+	var stack []entry
+	inserted := false
+	var buf bytes.Buffer
+	for _, l := range strings.Split(template, "\n") {
 		if len(l) == 0 {
 			continue
 		}
-		if strings.HasPrefix("spec:", l) {
-			templateForPod = templateForPod + l + "\n" + volume
-		} else {
-			templateForPod = templateForPod + l + "\n"
+		buf.WriteString(l + "\n")
+		trimmed := strings.TrimLeft(l, " ")
+		if inserted || strings.HasPrefix(trimmed, "{{") {
+			continue
 		}
-	}
-	return templateForPod
-}
-
-func addVolumeToTemplate(rc string, volumes string) string {
-	volumes = makeSpaceForVolume(volumes, "      ")
-	template := addVolumeInRcTemplate(rc, volumes)
-	return template
-}
-
-func addVolumeInRcTemplate(rc string, volumes string) string {
-	str := strings.Split(rc, "\n")
-	templateForPod := ""
-	for _, l := range str {
-		if len(l) == 0 {
+		indent := len(l) - len(trimmed)
+		for len(stack) != 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if !strings.HasSuffix(trimmed, ":") || strings.HasPrefix(trimmed, "- ") {
 			continue
 		}
-		if strings.HasPrefix("    spec:", l) {
-			templateForPod = templateForPod + l + "\n" + volumes
-		} else {
-			templateForPod = templateForPod + l + "\n"
+		stack = append(stack, entry{indent, strings.TrimSuffix(trimmed, ":")})
+		if len(stack) != len(path) {
+			continue
+		}
+		matched := true
+		for i, e := range stack {
+			if e.key != path[i] {
+				matched = false
+				break
+			}
 		}
+		if matched {
+			space := strings.Repeat(" ", indent+2)
+			for _, b := range strings.Split(block, "\n") {
+				if len(b) != 0 {
+					buf.WriteString(space + b + "\n")
+				}
+			}
+			inserted = true
+		}
+	}
+	return buf.String()
+}
 
+// insertIntoContainer inserts the yaml block returned by block, given the indentation of the
+// container fields, as fields of the container called name of a list of containers in template.
+func insertIntoContainer(template string, list string, name string, block func(indent int) string) string {
+	lines := strings.Split(strings.TrimSuffix(template, "\n"), "\n")
+	start, end, indent := findContainer(lines, list, name)
+	for i := start; i != -1 && i < end; i++ {
+		if field, fieldIndent, _ := yamlField(lines[i]); field == "name: "+name && fieldIndent == indent {
+			var blockLines []string
+			for _, b := range strings.Split(block(indent), "\n") {
+				if len(b) != 0 {
+					blockLines = append(blockLines, strings.Repeat(" ", indent)+b)
+				}
+			}
+			lines = insertLines(lines, i+1, blockLines)
+			break
+		}
 	}
-	return templateForPod
+	return strings.Join(lines, "\n") + "\n"
 }
 
-func generateServiceSpecTemplate(svc apiv1.ServiceSpec, key string, value map[string]interface{}) apiv1.ServiceSpec {
+func generateServiceSpecTemplate(svc apiv1.ServiceSpec, name string, key string, value map[string]interface{}) apiv1.ServiceSpec {
 	if len(svc.ClusterIP) != 0 {
 		value[ClusterIP] = svc.ClusterIP
 		svc.ClusterIP = fmt.Sprintf("{{.Values.%s.%s}}", key, ClusterIP)
@@ -634,6 +896,17 @@ func generateServiceSpecTemplate(svc apiv1.ServiceSpec, key string, value map[st
 		value[SessionAffinity] = string(svc.SessionAffinity)
 		svc.SessionAffinity = apiv1.ServiceAffinity(fmt.Sprintf("{{.Values.%s.%s}}", key, SessionAffinity))
 	}
+	// Ports, source ranges and the traffic policy are rendered from values by serviceTemplate.
+	if len(svc.Ports) != 0 {
+		generateServicePortValues(name, svc.Ports, value)
+		svc.Ports = nil
+	}
+	value[LoadBalancerSourceRanges] = svc.LoadBalancerSourceRanges
+	if svc.LoadBalancerSourceRanges == nil {
+		value[LoadBalancerSourceRanges] = []string{}
+	}
+	svc.LoadBalancerSourceRanges = nil
+	value[ExternalTrafficPolicy] = ""
 	return svc
 }
 
@@ -9,6 +9,8 @@ const (
 	ValuesfileName = "values.yaml"
 	// TemplatesDir is the relative directory name for templates.
 	TemplatesDir = "templates"
+	// CRDsDir is the relative directory name for CustomResourceDefinitions.
+	CRDsDir = "crds"
 	// HelpersName is the name of the example NOTES.txt file.
 	HelpersName = "_helpers.tpl"
 )
@@ -29,6 +31,19 @@ We truncate at 24 chars because some Kubernetes name fields are limited to this
 {{- $name := default .Chart.Name .Values.nameOverride -}}
 {{- printf "%s-%s" .Release.Name $name | trunc 24 -}}
 {{- end -}}
+
+{{/*
+Create the name of a service account of the chart. Called with a dict of the root context, the values
+key of the service account and its original name.
+*/}}
+{{- define "serviceAccountName" -}}
+{{- $values := index .root.Values .key -}}
+{{- if $values.serviceAccount.create -}}
+{{- default (printf "%s-%s" (include "fullname" .root) .name) $values.serviceAccount.name -}}
+{{- else -}}
+{{- default .name $values.serviceAccount.name -}}
+{{- end -}}
+{{- end -}}
 `
 
 type valueFileGenerator struct {
@@ -92,6 +107,62 @@ const (
 	MinReplicas                    = "minReplicas"
 	MaxReplicas                    = "maxReplicas"
 	TargetCPUUtilizationPercentage = "targetCPUUtilizationPercentage"
+	Ingress                        = "ingress"
+	ClassName                      = "className"
+	Annotations                    = "annotations"
+	DefaultBackend                 = "defaultBackend"
+	Hosts                          = "hosts"
+	TLS                            = "tls"
+	ServiceAccount                 = "serviceAccount"
+	Create                         = "create"
+	Schedule                       = "schedule"
+	Suspend                        = "suspend"
+	ConcurrencyPolicy              = "concurrencyPolicy"
+	StartingDeadlineSeconds        = "startingDeadlineSeconds"
+	SuccessfulJobsHistoryLimit     = "successfulJobsHistoryLimit"
+	FailedJobsHistoryLimit         = "failedJobsHistoryLimit"
+	NetworkPolicy                  = "networkPolicy"
+	PodDisruptionBudget            = "podDisruptionBudget"
+	MinAvailable                   = "minAvailable"
+	MaxUnavailable                 = "maxUnavailable"
+	Metrics                        = "metrics"
+	Behavior                       = "behavior"
+	PodManagementPolicy            = "podManagementPolicy"
+	UpdateStrategy                 = "updateStrategy"
+	Partition                      = "partition"
+	Size                           = "size"
+	StorageClass                   = "storageClass"
+	AccessModes                    = "accessModes"
+	ValidityDays                   = "validityDays"
+	Resources                      = "resources"
+	LivenessProbe                  = "livenessProbe"
+	ReadinessProbe                 = "readinessProbe"
+	StartupProbe                   = "startupProbe"
+	Lifecycle                      = "lifecycle"
+	NodeSelector                   = "nodeSelector"
+	Containers                     = "containers"
+	InitContainers                 = "initContainers"
+	Volumes                        = "volumes"
+	VolumeMounts                   = "volumeMounts"
+	Env                            = "env"
+	EnvFrom                        = "envFrom"
+	ExtraContainers                = "extraContainers"
+	ExtraInitContainers            = "extraInitContainers"
+	ExtraVolumes                   = "extraVolumes"
+	ExtraVolumeMounts              = "extraVolumeMounts"
+	ExtraEnv                       = "extraEnv"
+	ExtraEnvFrom                   = "extraEnvFrom"
+	Tolerations                    = "tolerations"
+	Affinity                       = "affinity"
+	TopologySpreadConstraints      = "topologySpreadConstraints"
+	PriorityClassName              = "priorityClassName"
+	RuntimeClassName               = "runtimeClassName"
+	Ports                          = "ports"
+	Port                           = "port"
+	TargetPort                     = "targetPort"
+	NodePort                       = "nodePort"
+	ExternalTrafficPolicy          = "externalTrafficPolicy"
+	LoadBalancerSourceRanges       = "loadBalancerSourceRanges"
 )
 
 func (v *valueFileGenerator) MergeInto(dst map[string]interface{}, key string) {
@@ -0,0 +1,198 @@
+package pkg
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	ylib "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	batch "k8s.io/client-go/pkg/apis/batch/v1"
+	batchv2 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// handledVersions lists the group/versions the handler of a kind can decode. Objects of other versions
+// are passed through instead of being decoded into the wrong type. Kinds not listed are handled in
+// every version.
+var handledVersions = map[string][]string{
+	"Pod":                     {"v1"},
+	"ReplicationController":   {"v1"},
+	"Deployment":              {"extensions/v1beta1", "apps/v1beta1", "apps/v1beta2", "apps/v1"},
+	"DaemonSet":               {"extensions/v1beta1", "apps/v1beta2", "apps/v1"},
+	"ReplicaSet":              {"extensions/v1beta1", "apps/v1beta2", "apps/v1"},
+	"StatefulSet":             {"apps/v1alpha1", "apps/v1beta1", "apps/v1beta2", "apps/v1"},
+	"Job":                     {"batch/v1"},
+	"CronJob":                 {"batch/v2alpha1", "batch/v1beta1", "batch/v1"},
+	"HorizontalPodAutoscaler": {"autoscaling/v1", "autoscaling/v2beta1", "autoscaling/v2beta2", "autoscaling/v2"},
+}
+
+// handledKind returns the kind of typeMeta if its handler can decode its version, "" otherwise.
+func handledKind(typeMeta metav1.TypeMeta) string {
+	versions, ok := handledVersions[typeMeta.Kind]
+	if !ok {
+		return typeMeta.Kind
+	}
+	for _, v := range versions {
+		if v == typeMeta.APIVersion {
+			return typeMeta.Kind
+		}
+	}
+	return ""
+}
+
+// knownFields is the vendored type of the object found at path.
+type knownFields struct {
+	known interface{}
+	path  []string
+}
+
+var podSpecPath = []string{"spec", "template", "spec"}
+
+// typedFields lists, for the kinds decoded into vendored types, where to look for fields added to the
+// API after those types.
+var typedFields = map[string][]knownFields{
+	"Pod":                   {{apiv1.PodSpec{}, []string{"spec"}}},
+	"ReplicationController": {{apiv1.ReplicationControllerSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"Deployment":            {{extensions.DeploymentSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"DaemonSet":             {{extensions.DaemonSetSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"ReplicaSet":            {{extensions.ReplicaSetSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"StatefulSet":           {{statefulSetSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"Job":                   {{batch.JobSpec{}, []string{"spec"}}, {apiv1.PodSpec{}, podSpecPath}},
+	"CronJob": {
+		{batchv2.CronJobSpec{}, []string{"spec"}},
+		{batch.JobSpec{}, []string{"spec", "jobTemplate", "spec"}},
+		{apiv1.PodSpec{}, []string{"spec", "jobTemplate", "spec", "template", "spec"}},
+	},
+	"Service": {{apiv1.ServiceSpec{}, []string{"spec"}}},
+}
+
+// addUnknownFields copies the fields of kubeJson that the vendored types of kind don't know, like
+// spec.minReadySeconds of an apps/v1 StatefulSet, into the template as they are. The startupProbe of
+// containers, the scheduling fields of pod specs and the externalTrafficPolicy of Services are set in
+// value instead, as they are rendered from values like the fields the vendored types know.
+func addUnknownFields(template string, kubeJson []byte, kind string, value map[string]interface{}) string {
+	for _, f := range typedFields[kind] {
+		fields := unknownFields(kubeJson, f.known, f.path...)
+		var values map[string]interface{}
+		switch f.known.(type) {
+		case apiv1.PodSpec:
+			values = schedulingValues(fields)
+		case apiv1.ServiceSpec:
+			values = serviceValues(fields)
+		}
+		for k, v := range values {
+			value[k] = v
+			delete(fields, k)
+		}
+		if len(fields) != 0 {
+			fieldsData, err := ylib.Marshal(fields)
+			if err != nil {
+				log.Fatal(err)
+			}
+			template = insertAt(template, string(fieldsData), f.path...)
+		}
+		if _, ok := f.known.(apiv1.PodSpec); ok {
+			template = addUnknownContainerFields(template, kubeJson, f.path, value)
+		}
+	}
+	return template
+}
+
+// addUnknownContainerFields copies the fields of the containers and init containers of the pod spec at
+// path that apiv1.Container doesn't know into the template.
+func addUnknownContainerFields(template string, kubeJson []byte, path []string, value map[string]interface{}) string {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(kubeJson, &obj); err != nil {
+		log.Fatal(err)
+	}
+	header := objectHeader{}
+	if err := json.Unmarshal(kubeJson, &header); err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range path {
+		obj, _ = obj[p].(map[string]interface{})
+	}
+	names := jsonFieldNames(reflect.TypeOf(apiv1.Container{}))
+	for _, list := range []string{Containers, InitContainers} {
+		containers, _ := obj[list].([]interface{})
+		if len(containers) == 0 {
+			continue
+		}
+		key, values := containerValues(generateSafeKey(header.Name), list, value)
+		for _, c := range containers {
+			container, _ := c.(map[string]interface{})
+			name, _ := container["name"].(string)
+			containerKey := generateSafeKey(name)
+			containerValue, _ := values[containerKey].(map[string]interface{})
+			probeValues := make(map[string]interface{})
+			fields := make(map[string]interface{})
+			for k, v := range container {
+				if names[k] {
+					continue
+				}
+				if k == StartupProbe && containerValue != nil {
+					probeValues[k] = probeValue(v)
+					containerValue[k] = probeValues[k]
+					continue
+				}
+				fields[k] = v
+			}
+			if len(fields) == 0 && len(probeValues) == 0 {
+				continue
+			}
+			template = insertIntoContainer(template, list, name, func(indent int) string {
+				block := containerFieldsTemplate(key, containerKey, probeValues, indent)
+				if len(fields) != 0 {
+					fieldsData, err := ylib.Marshal(fields)
+					if err != nil {
+						log.Fatal(err)
+					}
+					block += string(fieldsData)
+				}
+				return block
+			})
+		}
+	}
+	return template
+}
+
+// unknownFields returns the fields of the object at path in kubeJson that have no field in the type of known.
+func unknownFields(kubeJson []byte, known interface{}, path ...string) map[string]interface{} {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(kubeJson, &obj); err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range path {
+		obj, _ = obj[p].(map[string]interface{})
+	}
+	names := jsonFieldNames(reflect.TypeOf(known))
+	fields := make(map[string]interface{})
+	for k, v := range obj {
+		if !names[k] {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && len(name) == 0 {
+			for k := range jsonFieldNames(f.Type) {
+				names[k] = true
+			}
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
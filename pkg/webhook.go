@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+
+	ylib "github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// webhookConfiguration holds the fields of a MutatingWebhookConfiguration or
+// ValidatingWebhookConfiguration. The webhooks are kept as they are, apart from their client config.
+type webhookConfiguration struct {
+	objectHeader `json:",inline"`
+	Webhooks     []map[string]interface{} `json:"webhooks,omitempty"`
+}
+
+// webhookService is the Service a webhook is served by.
+type webhookService struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func (w webhookConfiguration) services() []webhookService {
+	var services []webhookService
+	for _, webhook := range w.Webhooks {
+		clientConfig, _ := webhook["clientConfig"].(map[string]interface{})
+		service, _ := clientConfig["service"].(map[string]interface{})
+		name, _ := service["name"].(string)
+		namespace, _ := service["namespace"].(string)
+		if len(name) != 0 {
+			services = append(services, webhookService{name, namespace})
+		}
+	}
+	return services
+}
+
+// webhookCerts holds the webhook configurations whose certificates are generated with
+// --gen-webhook-certs, by the index of their serving TLS Secret in the objects.
+type webhookCerts struct {
+	bySecret map[int][]webhookConfiguration
+	// generated holds the indexes of these configurations.
+	generated map[int]bool
+}
+
+// getWebhookCerts finds the TLS Secret serving each webhook configuration of objects, that is the Secret
+// whose certificate is valid for the Service of the webhooks. Configurations without one are reported.
+func getWebhookCerts(objects []string, rules SanitizeRules) (webhookCerts, []string) {
+	secretNames := make(map[int][]string)
+	var secrets []int
+	configs := make(map[int]webhookConfiguration)
+	var configIndexes []int
+	for i, v := range objects {
+		kubeJson, err := yaml.ToJSON([]byte(v))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if kubeJson, err = rules.SanitizeJSON(kubeJson); err != nil {
+			log.Fatal(err)
+		}
+		var header objectHeader
+		if err := json.Unmarshal(kubeJson, &header); err != nil {
+			log.Fatal(err)
+		}
+		switch header.Kind {
+		case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+			var config webhookConfiguration
+			if err := json.Unmarshal(kubeJson, &config); err != nil {
+				log.Fatal(err)
+			}
+			configs[i] = config
+			configIndexes = append(configIndexes, i)
+		case "Secret":
+			secret := apiv1.Secret{}
+			if err := json.Unmarshal(kubeJson, &secret); err != nil {
+				log.Fatal(err)
+			}
+			if names := certificateNames(secret.Data[apiv1.TLSCertKey]); len(names) != 0 {
+				secretNames[i] = names
+				secrets = append(secrets, i)
+			}
+		}
+	}
+
+	certs := webhookCerts{make(map[int][]webhookConfiguration), make(map[int]bool)}
+	var missing []string
+	for _, i := range configIndexes {
+		config := configs[i]
+		services := config.services()
+		found := false
+		for _, s := range secrets {
+			if len(services) != 0 && servesAll(secretNames[s], services) {
+				certs.bySecret[s] = append(certs.bySecret[s], config)
+				certs.generated[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("%s %s", config.Kind, config.Name))
+		}
+	}
+	return certs, missing
+}
+
+// certificateNames returns the DNS names and common name of the PEM encoded certificate.
+func certificateNames(data []byte) []string {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return append(cert.DNSNames, cert.Subject.CommonName)
+}
+
+func servesAll(names []string, services []webhookService) bool {
+	for _, s := range services {
+		served := false
+		for _, name := range names {
+			served = served || name == fmt.Sprintf("%s.%s.svc", s.Name, s.Namespace)
+		}
+		if !served {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookConfigurationTemplate templates the name of the configuration and the Services of its
+// webhooks. With certs, the CA bundle of the webhooks served by the Service of the certificate is
+// the generated CA.
+func webhookConfigurationTemplate(config webhookConfiguration, certs *webhookService) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&config.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(config.ObjectMeta.Name)
+	name := config.ObjectMeta.Name
+	config.ObjectMeta = generateObjectMetaTemplate(config.ObjectMeta, key, value, name)
+	config.ObjectMeta.Name = clusterScopedName(name)
+	header, err := ylib.Marshal(config.objectHeader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, webhook := range config.Webhooks {
+		clientConfig, _ := webhook["clientConfig"].(map[string]interface{})
+		service, _ := clientConfig["service"].(map[string]interface{})
+		if service == nil {
+			continue
+		}
+		name, _ := service["name"].(string)
+		namespace, _ := service["namespace"].(string)
+		if certs != nil && *certs == (webhookService{name, namespace}) {
+			clientConfig["caBundle"] = "{{ $ca.Cert | b64enc }}"
+			service["name"] = "{{ $service }}"
+			service["namespace"] = "{{ $namespace }}"
+		} else if checkIfNameExist(name, "Service") {
+			if _, ok := clientConfig["caBundle"]; ok {
+				fmt.Printf("WARNING: %s %s: the caBundle is kept as captured, its certificate may not be valid for the templated name and namespace of Service %s\n", config.Kind, config.ObjectMeta.Name, name)
+			}
+			if !PreserveName {
+				service["name"] = fmt.Sprintf(`{{ template "fullname" . }}-%s`, name)
+			}
+			service["namespace"] = fmt.Sprintf("{{ default .Release.Namespace .Values.%s.%s }}", generateSafeKey(name), Namespace)
+		}
+	}
+	// The webhooks are marshalled on their own, as removeEmptyFields would drop the "" of the core API group.
+	webhooks, err := ylib.Marshal(map[string]interface{}{"webhooks": config.Webhooks})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return removeEmptyFields(string(header)) + string(webhooks), valueFileGenerator{value: value}
+}
+
+// webhookCertsTemplate renders the serving TLS Secret and the webhook configurations using it in one
+// template, so that they share a CA and certificate generated with genCA and genSignedCert for the
+// templated name and namespace of the Service. They are valid for <secret>.validityDays.
+func webhookCertsTemplate(secret apiv1.Secret, configs []webhookConfiguration) (string, valueFileGenerator) {
+	cleanUpObjectMeta(&secret.ObjectMeta)
+	value := make(map[string]interface{}, 0)
+	key := generateSafeKey(secret.ObjectMeta.Name)
+	secret.ObjectMeta = generateObjectMetaTemplate(secret.ObjectMeta, key, value, secret.ObjectMeta.Name)
+	value[ValidityDays] = 3650
+	_, hasCA := secret.Data["ca.crt"]
+	secret.Data = nil
+	secret.Type = apiv1.SecretTypeTLS
+	secretData, err := ylib.Marshal(secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	service := configs[0].services()[0]
+	validity := fmt.Sprintf("(int .Values.%s.%s)", key, ValidityDays)
+	var buf bytes.Buffer
+	if !PreserveName && checkIfNameExist(service.Name, "Service") {
+		fmt.Fprintf(&buf, "{{- $service := printf \"%%s-%%s\" (include \"fullname\" .) %q }}\n", service.Name)
+	} else {
+		fmt.Fprintf(&buf, "{{- $service := %q }}\n", service.Name)
+	}
+	if checkIfNameExist(service.Name, "Service") {
+		fmt.Fprintf(&buf, "{{- $namespace := default .Release.Namespace .Values.%s.%s }}\n", generateSafeKey(service.Name), Namespace)
+	} else {
+		fmt.Fprintf(&buf, "{{- $namespace := %q }}\n", service.Namespace)
+	}
+	buf.WriteString(`{{- $cn := printf "%s.%s.svc" $service $namespace }}` + "\n")
+	fmt.Fprintf(&buf, "{{- $ca := genCA (printf \"%%s-ca\" $service) %s }}\n", validity)
+	fmt.Fprintf(&buf, "{{- $cert := genSignedCert $cn nil (list $service (printf \"%%s.%%s\" $service $namespace) $cn (printf \"%%s.cluster.local\" $cn)) %s $ca }}\n", validity)
+	buf.WriteString(removeEmptyFields(string(secretData)))
+	buf.WriteString("data:\n")
+	buf.WriteString("  tls.crt: {{ $cert.Cert | b64enc }}\n")
+	buf.WriteString("  tls.key: {{ $cert.Key | b64enc }}\n")
+	if hasCA {
+		buf.WriteString("  ca.crt: {{ $ca.Cert | b64enc }}\n")
+	}
+	for _, config := range configs {
+		// The configurations are cluster scoped, their metadata has no values.
+		template, _ := webhookConfigurationTemplate(config, &service)
+		buf.WriteString("---\n" + template)
+	}
+	return buf.String(), valueFileGenerator{value: value}
+}